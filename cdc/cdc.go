@@ -0,0 +1,120 @@
+package cdc
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+type Params struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+var DefaultParams = Params{
+	MinSize: 2 << 10,
+	AvgSize: 8 << 10,
+	MaxSize: 64 << 10,
+}
+
+const maxChunkSize = 1 << 30
+
+func (p Params) Validate() error {
+	if p.MinSize <= 0 || p.MinSize > p.AvgSize || p.AvgSize > p.MaxSize {
+		return fmt.Errorf("invalid chunk sizes, want 0 < min <= avg <= max, got min = %d, avg = %d, max = %d", p.MinSize, p.AvgSize, p.MaxSize)
+	}
+	if p.MaxSize > maxChunkSize {
+		return fmt.Errorf("too big max chunk size = %d, max = %d", p.MaxSize, maxChunkSize)
+	}
+	return nil
+}
+
+type Chunker struct {
+	in         io.Reader
+	params     Params
+	maskSmall  uint64
+	maskLarge  uint64
+	buffer     []byte
+	start, end int
+	eof        bool
+}
+
+func NewChunker(in io.Reader, params Params) (*Chunker, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	avgBits := bits.Len(uint(params.AvgSize)) - 1
+	return &Chunker{
+		in:        in,
+		params:    params,
+		maskSmall: mask(avgBits + 1),
+		maskLarge: mask(avgBits - 1),
+		buffer:    make([]byte, 2*params.MaxSize),
+	}, nil
+}
+
+func mask(ones int) uint64 {
+	if ones <= 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - ones)
+}
+
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cutPoint(c.buffer[c.start:c.end])
+	chunk := c.buffer[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.params.MaxSize {
+		return nil
+	}
+	copy(c.buffer, c.buffer[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+	n, err := io.ReadFull(c.in, c.buffer[c.end:])
+	c.end += n
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
+
+func (c *Chunker) cutPoint(data []byte) int {
+	n := len(data)
+	if n <= c.params.MinSize {
+		return n
+	}
+	if n > c.params.MaxSize {
+		n = c.params.MaxSize
+	}
+	normal := c.params.AvgSize
+	if normal > n {
+		normal = n
+	}
+	hash := uint64(0)
+	i := c.params.MinSize
+	for ; i < normal; i++ {
+		hash = hash<<1 + gearTable[data[i]]
+		if hash&c.maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = hash<<1 + gearTable[data[i]]
+		if hash&c.maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,111 @@
+package cdc
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chunks(t *testing.T, in io.Reader, params Params) [][]byte {
+	chunker, err := NewChunker(in, params)
+	assert.NoError(t, err)
+	var got [][]byte
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return got
+		}
+		assert.NoError(t, err)
+		got = append(got, append([]byte(nil), chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	params := Params{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+	tests := []struct {
+		desc     string
+		giveSize int
+	}{
+		{desc: "should handle empty input", giveSize: 0},
+		{desc: "should handle input shorter than min size", giveSize: 100},
+		{desc: "should handle input shorter than max size", giveSize: 3000},
+		{desc: "should handle long input", giveSize: 1 << 20},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			giveData := make([]byte, tc.giveSize)
+			rnd.Read(giveData)
+
+			got := chunks(t, bytes.NewReader(giveData), params)
+			assert.Equal(t, giveData, bytes.Join(got, nil))
+			for i, chunk := range got {
+				assert.LessOrEqual(t, len(chunk), params.MaxSize)
+				if i < len(got)-1 {
+					assert.GreaterOrEqual(t, len(chunk), params.MinSize)
+				}
+			}
+			assert.Equal(t, got, chunks(t, iotest.OneByteReader(bytes.NewReader(giveData)), params))
+		})
+	}
+}
+
+func TestChunkerAverageSize(t *testing.T) {
+	giveData := make([]byte, 8<<20)
+	rand.New(rand.NewSource(2)).Read(giveData)
+
+	got := chunks(t, bytes.NewReader(giveData), DefaultParams)
+	avg := len(giveData) / len(got)
+	assert.InDelta(t, DefaultParams.AvgSize, avg, float64(DefaultParams.AvgSize)/2)
+}
+
+func TestChunkerResynchronizes(t *testing.T) {
+	giveData := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(giveData)
+	params := Params{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+	edited := append(append(append([]byte(nil), giveData[:1000]...), []byte("inserted")...), giveData[1000:]...)
+
+	before := map[string]bool{}
+	for _, chunk := range chunks(t, bytes.NewReader(giveData), params) {
+		before[string(chunk)] = true
+	}
+	after := chunks(t, bytes.NewReader(edited), params)
+	shared := 0
+	for _, chunk := range after {
+		if before[string(chunk)] {
+			shared++
+		}
+	}
+	assert.GreaterOrEqual(t, shared, len(after)-3)
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := []struct {
+		desc       string
+		giveParams Params
+		wantErr    bool
+	}{
+		{desc: "should accept default params", giveParams: DefaultParams},
+		{desc: "should accept equal sizes", giveParams: Params{MinSize: 64, AvgSize: 64, MaxSize: 64}},
+		{desc: "should reject zero min size", giveParams: Params{MinSize: 0, AvgSize: 64, MaxSize: 128}, wantErr: true},
+		{desc: "should reject min above avg", giveParams: Params{MinSize: 128, AvgSize: 64, MaxSize: 256}, wantErr: true},
+		{desc: "should reject avg above max", giveParams: Params{MinSize: 32, AvgSize: 256, MaxSize: 128}, wantErr: true},
+		{desc: "should reject too big max", giveParams: Params{MinSize: 32, AvgSize: 256, MaxSize: 1<<30 + 1}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.giveParams.Validate()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package cdc
+
+var gearTable = newGearTable(0x2545f4914f6cdd1d)
+
+func newGearTable(seed uint64) [256]uint64 {
+	table := [256]uint64{}
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
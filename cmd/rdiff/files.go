@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const stdStream string = "-"
+
+type output struct {
+	io.Writer
+	ctx    context.Context
+	file   *os.File
+	path   string
+	direct bool
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == stdStream {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+func inputSize(in io.Reader) int64 {
+	file, ok := in.(*os.File)
+	if !ok {
+		return -1
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	return info.Size()
+}
+
+func createOutput(ctx context.Context, path string) (*output, error) {
+	if path == stdStream {
+		return &output{Writer: os.Stdout, ctx: ctx}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil && !info.Mode().IsRegular() {
+		return createDirectOutput(ctx, path)
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if os.IsPermission(err) && info != nil {
+		return createDirectOutput(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &output{Writer: file, ctx: ctx, file: file, path: path}, nil
+}
+
+func createDirectOutput(ctx context.Context, path string) (*output, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &output{Writer: file, ctx: ctx, file: file, path: path, direct: true}, nil
+}
+
+func (o *output) commit() error {
+	if err := o.ctx.Err(); err != nil {
+		o.Close()
+		return err
+	}
+	if o.file == nil {
+		return nil
+	}
+	file := o.file
+	o.file = nil
+	if o.direct {
+		return file.Close()
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), o.path)
+}
+
+func (o *output) Close() error {
+	if o.file == nil {
+		return nil
+	}
+	file := o.file
+	o.file = nil
+	if o.direct {
+		return file.Close()
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+type dirCleanup struct {
+	root     string
+	created  bool
+	existing map[string]bool
+}
+
+func newDirCleanup(path string) (*dirCleanup, error) {
+	c := &dirCleanup{root: filepath.Clean(path)}
+	for dir := c.root; ; {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		c.root, c.created = dir, true
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	if c.created {
+		return c, nil
+	}
+	entries, err := ioutil.ReadDir(c.root)
+	if err != nil {
+		return nil, err
+	}
+	c.existing = map[string]bool{}
+	for _, e := range entries {
+		c.existing[e.Name()] = true
+	}
+	return c, nil
+}
+
+func (c *dirCleanup) remove() {
+	if c.created {
+		os.RemoveAll(c.root)
+		return
+	}
+	entries, err := ioutil.ReadDir(c.root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !c.existing[e.Name()] {
+			os.RemoveAll(filepath.Join(c.root, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOutput(t *testing.T) {
+	tests := []struct {
+		desc        string
+		givePath    func(dir string) string
+		giveDevice  bool
+		wantRegular bool
+	}{
+		{
+			desc:        "should create missing file",
+			givePath:    func(dir string) string { return filepath.Join(dir, "out") },
+			wantRegular: true,
+		},
+		{
+			desc: "should replace regular file",
+			givePath: func(dir string) string {
+				path := filepath.Join(dir, "out")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old content"), 0644))
+				return path
+			},
+			wantRegular: true,
+		},
+		{
+			desc:       "should write to device",
+			givePath:   func(dir string) string { return os.DevNull },
+			giveDevice: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			path := tc.givePath(dir)
+			if tc.giveDevice {
+				skipUnlessDevice(t, path)
+			}
+
+			out, err := createOutput(context.Background(), path)
+			assert.NoError(t, err)
+			_, err = out.Write([]byte("new"))
+			assert.NoError(t, err)
+			assert.NoError(t, out.commit())
+
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantRegular, info.Mode().IsRegular())
+			if tc.wantRegular {
+				got, err := ioutil.ReadFile(path)
+				assert.NoError(t, err)
+				assert.Equal(t, "new", string(got))
+			}
+			entries, err := ioutil.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, len(entries), 1)
+		})
+	}
+}
+
+func TestCreateOutputCanceled(t *testing.T) {
+	skipUnlessDevice(t, os.DevNull)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out, err := createOutput(ctx, os.DevNull)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, out.commit(), context.Canceled)
+	info, err := os.Stat(os.DevNull)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeDevice)
+}
+
+func skipUnlessDevice(t *testing.T, path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeDevice == 0 {
+		t.Skipf("%s is not a device", path)
+	}
+}
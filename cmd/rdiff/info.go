@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+type commandInfo struct {
+	deltaFilePath string
+	format        string
+	json          bool
+}
+
+type deltaReport struct {
+	Compression     string        `json:"compression"`
+	Encoding        string        `json:"encoding"`
+	Chunks          []chunkReport `json:"chunks"`
+	ChunkCount      int           `json:"chunkCount"`
+	CopiedBytes     uint64        `json:"copiedBytes"`
+	LiteralBytes    uint64        `json:"literalBytes"`
+	SelfCopiedBytes uint64        `json:"selfCopiedBytes"`
+	OutputSize      uint64        `json:"outputSize"`
+	DeltaSize       int64         `json:"deltaSize"`
+	Ratio           float64       `json:"ratio"`
+}
+
+type chunkReport struct {
+	Type         string  `json:"type"`
+	BaseOffset   *uint64 `json:"baseOffset,omitempty"`
+	Length       uint64  `json:"length"`
+	OutputOffset uint64  `json:"outputOffset"`
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (c *commandInfo) execute(ctx context.Context) error {
+	deltaFile, err := openInput(c.deltaFilePath)
+	if err != nil {
+		return err
+	}
+	defer deltaFile.Close()
+	in := &countingReader{Reader: deltaFile}
+	var delta *librsync.Delta
+	if c.format == formatLibrsync {
+		delta, err = librsync.ReadLibrsyncDelta(bufio.NewReader(in))
+	} else {
+		delta, err = librsync.ReadDelta(bufio.NewReader(in))
+	}
+	if err != nil {
+		return err
+	}
+	report := newDeltaReport(delta, in.n)
+	if c.json {
+		return printJSON(report)
+	}
+	return report.print(os.Stdout)
+}
+
+func newDeltaReport(delta *librsync.Delta, deltaSize int64) *deltaReport {
+	summary := delta.Summary()
+	report := &deltaReport{
+		Compression:     delta.Compression().String(),
+		Encoding:        delta.Encoding().String(),
+		Chunks:          []chunkReport{},
+		ChunkCount:      summary.Chunks,
+		CopiedBytes:     summary.CopiedBytes,
+		LiteralBytes:    summary.LiteralBytes,
+		SelfCopiedBytes: summary.SelfCopiedBytes,
+		OutputSize:      summary.OutputSize(),
+		DeltaSize:       deltaSize,
+	}
+	if report.OutputSize > 0 {
+		report.Ratio = float64(deltaSize) / float64(report.OutputSize)
+	}
+	for _, info := range delta.Chunks() {
+		chunk := chunkReport{
+			Type:         info.Kind.String(),
+			Length:       info.Length,
+			OutputOffset: info.OutputOffset,
+		}
+		if info.Kind != librsync.ChunkLiteral {
+			baseOffset := info.BaseOffset
+			chunk.BaseOffset = &baseOffset
+		}
+		report.Chunks = append(report.Chunks, chunk)
+	}
+	return report
+}
+
+func (r *deltaReport) print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "#\ttype\tbase offset\tlength\toutput offset")
+	for i, chunk := range r.Chunks {
+		baseOffset := "-"
+		if chunk.BaseOffset != nil {
+			baseOffset = fmt.Sprint(*chunk.BaseOffset)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\n", i, chunk.Type, baseOffset, chunk.Length, chunk.OutputOffset)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, `
+compression:       %s
+encoding:          %s
+chunks:            %d
+copied bytes:      %d
+literal bytes:     %d
+self-copied bytes: %d
+output size:       %d
+delta size:        %d
+ratio:             %.4f
+`, r.Compression, r.Encoding, r.ChunkCount, r.CopiedBytes, r.LiteralBytes, r.SelfCopiedBytes, r.OutputSize, r.DeltaSize, r.Ratio)
+	return err
+}
+
+type commandSigInfo struct {
+	signatureFilePath string
+	format            string
+	json              bool
+}
+
+type signatureReport struct {
+	BlockLength  uint32        `json:"blockLength"`
+	StrongHash   string        `json:"strongHash"`
+	StrongLength uint32        `json:"strongLength"`
+	RollingHash  string        `json:"rollingHash"`
+	BlockCount   int           `json:"blockCount"`
+	Blocks       []blockReport `json:"blocks"`
+}
+
+type blockReport struct {
+	Offset    uint64 `json:"offset"`
+	WeakSum   uint32 `json:"weakSum"`
+	StrongSum string `json:"strongSum"`
+}
+
+func (c *commandSigInfo) execute(ctx context.Context) error {
+	sig, err := readSignatureFile(c.signatureFilePath, c.format)
+	if err != nil {
+		return err
+	}
+	report := &signatureReport{
+		BlockLength:  sig.BlockLength(),
+		StrongHash:   sig.StrongHash().String(),
+		StrongLength: sig.StrongLength(),
+		RollingHash:  sig.RollingHash().String(),
+		BlockCount:   sig.BlockCount(),
+		Blocks:       []blockReport{},
+	}
+	for _, block := range sig.Blocks() {
+		report.Blocks = append(report.Blocks, blockReport{
+			Offset:    block.Offset,
+			WeakSum:   block.WeakSum,
+			StrongSum: hex.EncodeToString(block.StrongSum),
+		})
+	}
+	if c.json {
+		return printJSON(report)
+	}
+	return report.print(os.Stdout)
+}
+
+func (r *signatureReport) print(out io.Writer) error {
+	_, err := fmt.Fprintf(out, `block length:  %d
+strong hash:   %s
+strong length: %d
+rolling hash:  %s
+blocks:        %d
+
+`, r.BlockLength, r.StrongHash, r.StrongLength, r.RollingHash, r.BlockCount)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "#\toffset\tweak sum\tstrong sum")
+	for i, block := range r.Blocks {
+		fmt.Fprintf(w, "%d\t%d\t%08x\t%s\n", i, block.Offset, block.WeakSum, block.StrongSum)
+	}
+	return w.Flush()
+}
+
+type commandSigDiff struct {
+	firstSignatureFilePath  string
+	secondSignatureFilePath string
+	format                  string
+	json                    bool
+}
+
+type blockDiffReport struct {
+	Index  uint64 `json:"index"`
+	Offset uint64 `json:"offset"`
+	Change string `json:"change"`
+}
+
+func (c *commandSigDiff) execute(ctx context.Context) error {
+	first, err := readSignatureFile(c.firstSignatureFilePath, c.format)
+	if err != nil {
+		return err
+	}
+	second, err := readSignatureFile(c.secondSignatureFilePath, c.format)
+	if err != nil {
+		return err
+	}
+	diffs, err := librsync.DiffSignatures(first, second)
+	if errors.Is(err, librsync.ErrBlockSizeMismatch) {
+		return fmt.Errorf("%w; create both signatures with the same --block-size", err)
+	}
+	if err != nil {
+		return err
+	}
+	report := []blockDiffReport{}
+	for _, diff := range diffs {
+		report = append(report, blockDiffReport{Index: diff.Index, Offset: diff.Offset, Change: diff.Change.String()})
+	}
+	if c.json {
+		return printJSON(report)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "block\toffset\tchange")
+	for _, diff := range report {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", diff.Index, diff.Offset, diff.Change)
+	}
+	return w.Flush()
+}
+
+func readSignatureFile(path, format string) (*librsync.Signature, error) {
+	sigFile, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer sigFile.Close()
+	if format == formatLibrsync {
+		return librsync.ReadLibrsyncSignature(bufio.NewReader(sigFile))
+	}
+	return librsync.ReadSignature(bufio.NewReader(sigFile))
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
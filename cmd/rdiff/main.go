@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
 
+	"github.com/Pirellik/simple-rdiff/cdc"
 	"github.com/Pirellik/simple-rdiff/librsync"
+	"github.com/Pirellik/simple-rdiff/netsync"
+	"github.com/Pirellik/simple-rdiff/tree"
 )
 
 const (
@@ -14,148 +22,699 @@ const (
 	signatureCmd string = "signature"
 	deltaCmd     string = "delta"
 	patchCmd     string = "patch"
+	invertCmd    string = "invert"
+	composeCmd   string = "compose"
+	infoCmd      string = "info"
+	sigInfoCmd   string = "sig-info"
+	sigDiffCmd   string = "sig-diff"
+
+	signatureDirCmd string = "signature-dir"
+	deltaDirCmd     string = "delta-dir"
+	patchDirCmd     string = "patch-dir"
+
+	serveCmd string = "serve"
+	pullCmd  string = "pull"
+
+	formatNative   string = "native"
+	formatLibrsync string = "librsync"
+
+	chunkingFixed string = "fixed"
+	chunkingCDC   string = "cdc"
 
 	helpMsg string = `Usage:
 	rdiff help
 	rdiff [options] signature old-file signature-file
 	rdiff [options] delta signature-file new-file delta-file
 	rdiff [options] patch basis-file delta-file new-file
+	rdiff [options] --inplace patch basis-file delta-file
+	rdiff [options] invert basis-file delta-file reverse-delta-file
+	rdiff [options] compose first-delta-file second-delta-file composed-delta-file
+	rdiff [options] info delta-file
+	rdiff [options] sig-info signature-file
+	rdiff [options] sig-diff first-signature-file second-signature-file
+	rdiff [options] signature-dir old-dir signature-archive
+	rdiff [options] delta-dir signature-archive new-dir delta-archive
+	rdiff [options] patch-dir basis-dir delta-archive new-dir
+	rdiff [options] serve dir
+	rdiff [options] pull host:port remote-path local-path
+Any file except basis-file can be "-" to use stdin or stdout, directories cannot.
+Interrupting with Ctrl-C removes partially written output files.
+An in-place patch can only be interrupted before it starts modifying basis-file.
 Options:
-	--block-size	size of the block in bytes
+	--block-size	size of the block in bytes, 0 to choose it from the old-file size (default 0)
+		(signatures compared with sig-diff must share an explicit block size)
+	--format	file format: native or librsync (default native)
+	--hash	strong hash algorithm: sha256, sha512-256, blake2b, md5, md4 or fnv128
+		(default sha256, blake2b for librsync format)
+	--sum-size	strong hash length in bytes, 0 for the full digest
+		(content-defined chunking requires the full digest)
+	--rolling-hash	rolling hash algorithm: rollsum, rollsum-librsync, rabinkarp, buzhash or gear
+		(default rollsum, rollsum-librsync for librsync format)
+	--compress	compress literal data in the delta (native format only)
+	--compact	use variable-length chunk headers in the delta (native format only)
+	--jobs	number of signature hashing workers, 0 for one per CPU (default 1)
+	--chunking	block chunking: fixed or cdc for content-defined chunks (default fixed, native format only)
+	--min-chunk, --avg-chunk, --max-chunk	content-defined chunk sizes in bytes (default 2048, 8192, 65536)
+	--json	print info reports as JSON
+	--inplace	patch basis-file in place instead of writing new-file
+	--listen	address for serve to listen on (default :7811)
+	--self-copies	reuse content repeated within new-file, up to 16 MiB back (native format only)
+	--progress	show throughput of signature, delta and patch on stderr, with estimated time left for signature and delta
 	`
 )
 
 type command interface {
-	execute() error
+	execute(ctx context.Context) error
 }
 
 type commandSignature struct {
 	baseFilePath      string
 	signatureFilePath string
 	blockLength       uint32
+	format            string
+	sigOpts           []librsync.SignatureOption
+	jobs              int
+	cdcParams         *cdc.Params
+	progress          bool
 }
 
-func (c *commandSignature) execute() error {
-	base, err := os.Open(c.baseFilePath)
+func (c *commandSignature) execute(ctx context.Context) error {
+	base, err := openInput(c.baseFilePath)
 	if err != nil {
 		return err
 	}
 	defer base.Close()
-	sig, err := librsync.NewSignature(base, c.blockLength)
+	size := inputSize(base)
+	if c.progress {
+		display := newProgressDisplay(os.Stderr, size)
+		defer display.finish()
+		c.sigOpts = append(c.sigOpts, librsync.WithSignatureProgress(display.update))
+	}
+	if c.cdcParams != nil {
+		return c.executeCDC(ctx, base)
+	}
+	if c.blockLength == 0 {
+		c.blockLength = librsync.AutoBlockLength(size)
+	}
+	var sig *librsync.Signature
+	switch {
+	case c.format == formatLibrsync:
+		sig, err = librsync.NewLibrsyncSignatureContext(ctx, base, c.blockLength, c.sigOpts...)
+	case c.jobs != 1 && size >= 0:
+		sig, err = librsync.NewSignatureParallelContext(ctx, base.(*os.File), size, c.blockLength, c.jobs, c.sigOpts...)
+	default:
+		sig, err = librsync.NewSignatureContext(ctx, base, c.blockLength, c.sigOpts...)
+	}
 	if err != nil {
 		return err
 	}
-	sigFile, err := os.Create(c.signatureFilePath)
+	sigFile, err := createOutput(ctx, c.signatureFilePath)
 	if err != nil {
 		return err
 	}
 	defer sigFile.Close()
-	return sig.Write(sigFile)
+	if c.format == formatLibrsync {
+		err = sig.WriteLibrsync(sigFile)
+	} else {
+		err = sig.Write(sigFile)
+	}
+	if err != nil {
+		return err
+	}
+	return sigFile.commit()
+}
+
+func (c *commandSignature) executeCDC(ctx context.Context, base io.Reader) error {
+	sig, err := librsync.NewCDCSignatureContext(ctx, base, *c.cdcParams, c.sigOpts...)
+	if err != nil {
+		return err
+	}
+	sigFile, err := createOutput(ctx, c.signatureFilePath)
+	if err != nil {
+		return err
+	}
+	defer sigFile.Close()
+	if err := sig.Write(sigFile); err != nil {
+		return err
+	}
+	return sigFile.commit()
 }
 
 type commandDelta struct {
 	srcFilePath       string
 	signatureFilePath string
 	deltaFilePath     string
+	format            string
+	compression       librsync.Compression
+	encoding          librsync.Encoding
+	chunking          string
+	selfCopyWindow    uint32
+	progress          bool
 }
 
-func (c *commandDelta) execute() error {
-	src, err := os.Open(c.srcFilePath)
+func (c *commandDelta) execute(ctx context.Context) error {
+	src, err := openInput(c.srcFilePath)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
-	sigFile, err := os.Open(c.signatureFilePath)
+	sigFile, err := openInput(c.signatureFilePath)
 	if err != nil {
 		return err
 	}
 	defer sigFile.Close()
-	sig, err := librsync.ReadSignature(sigFile)
+	opts := []librsync.DeltaOption{
+		librsync.WithCompression(c.compression),
+		librsync.WithEncoding(c.encoding),
+		librsync.WithSelfCopyWindow(c.selfCopyWindow),
+	}
+	if c.progress {
+		display := newProgressDisplay(os.Stderr, inputSize(src))
+		defer display.finish()
+		opts = append(opts, librsync.WithDeltaProgress(display.update))
+	}
+	if c.chunking == chunkingCDC {
+		return c.executeCDC(ctx, src, sigFile, opts)
+	}
+	var sig *librsync.Signature
+	if c.format == formatLibrsync {
+		sig, err = librsync.ReadLibrsyncSignature(sigFile)
+	} else {
+		sig, err = librsync.ReadSignature(sigFile)
+	}
+	if err != nil {
+		return err
+	}
+	deltaFile, err := createOutput(ctx, c.deltaFilePath)
+	if err != nil {
+		return err
+	}
+	defer deltaFile.Close()
+	if c.format == formatLibrsync {
+		err = librsync.WriteLibrsyncDeltaContext(ctx, src, sig, deltaFile, opts...)
+	} else {
+		err = librsync.WriteDeltaContext(ctx, src, sig, deltaFile, opts...)
+	}
 	if err != nil {
 		return err
 	}
-	delta, err := librsync.NewDelta(src, sig)
+	return deltaFile.commit()
+}
+
+func (c *commandDelta) executeCDC(ctx context.Context, src, sigFile io.Reader, opts []librsync.DeltaOption) error {
+	sig, err := librsync.ReadCDCSignature(sigFile)
 	if err != nil {
 		return err
 	}
-	deltaFile, err := os.Create(c.deltaFilePath)
+	deltaFile, err := createOutput(ctx, c.deltaFilePath)
 	if err != nil {
 		return err
 	}
 	defer deltaFile.Close()
-	return delta.Write(deltaFile)
+	if err := librsync.WriteCDCDeltaContext(ctx, src, sig, deltaFile, opts...); err != nil {
+		return err
+	}
+	return deltaFile.commit()
 }
 
 type commandPatch struct {
 	baseFilePath  string
 	deltaFilePath string
 	outFilePath   string
+	format        string
+	progress      bool
+}
+
+func (c *commandPatch) execute(ctx context.Context) error {
+	base, err := os.Open(c.baseFilePath)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+	deltaFile, err := openInput(c.deltaFilePath)
+	if err != nil {
+		return err
+	}
+	defer deltaFile.Close()
+	out, err := createOutput(ctx, c.outFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	opts := []librsync.PatchOption{}
+	if c.progress {
+		display := newOutputProgressDisplay(os.Stderr)
+		defer display.finish()
+		opts = append(opts, librsync.WithPatchProgress(display.update))
+	}
+	if c.format == formatLibrsync {
+		err = librsync.ApplyLibrsyncPatchContext(ctx, base, deltaFile, out, opts...)
+	} else {
+		err = librsync.ApplyPatchContext(ctx, base, deltaFile, out, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	return out.commit()
 }
 
-func (c *commandPatch) execute() error {
+type commandPatchInPlace struct {
+	baseFilePath  string
+	deltaFilePath string
+	format        string
+}
+
+func (c *commandPatchInPlace) execute(ctx context.Context) error {
+	delta, err := readDeltaFile(c.deltaFilePath, c.format)
+	if err != nil {
+		return err
+	}
+	base, err := os.OpenFile(c.baseFilePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := delta.PatchInPlaceContext(ctx, base); err != nil {
+		base.Close()
+		return err
+	}
+	return base.Close()
+}
+
+type commandInvert struct {
+	baseFilePath         string
+	deltaFilePath        string
+	reverseDeltaFilePath string
+	format               string
+}
+
+func (c *commandInvert) execute(ctx context.Context) error {
 	base, err := os.Open(c.baseFilePath)
 	if err != nil {
 		return err
 	}
 	defer base.Close()
-	deltaFile, err := os.Open(c.deltaFilePath)
+	delta, err := readDeltaFile(c.deltaFilePath, c.format)
+	if err != nil {
+		return err
+	}
+	reverse, err := delta.Invert(base)
+	if err != nil {
+		return err
+	}
+	return writeDeltaFile(ctx, c.reverseDeltaFilePath, c.format, reverse)
+}
+
+type commandCompose struct {
+	firstDeltaFilePath    string
+	secondDeltaFilePath   string
+	composedDeltaFilePath string
+	format                string
+}
+
+func (c *commandCompose) execute(ctx context.Context) error {
+	first, err := readDeltaFile(c.firstDeltaFilePath, c.format)
+	if err != nil {
+		return err
+	}
+	second, err := readDeltaFile(c.secondDeltaFilePath, c.format)
 	if err != nil {
 		return err
 	}
+	composed, err := librsync.Compose(first, second)
+	if err != nil {
+		return err
+	}
+	return writeDeltaFile(ctx, c.composedDeltaFilePath, c.format, composed)
+}
+
+func readDeltaFile(path, format string) (*librsync.Delta, error) {
+	deltaFile, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
 	defer deltaFile.Close()
-	delta, err := librsync.ReadDelta(deltaFile)
+	if format == formatLibrsync {
+		return librsync.ReadLibrsyncDelta(bufio.NewReader(deltaFile))
+	}
+	return librsync.ReadDelta(bufio.NewReader(deltaFile))
+}
+
+func writeDeltaFile(ctx context.Context, path, format string, delta *librsync.Delta) error {
+	out, err := createOutput(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	bufOut := bufio.NewWriter(out)
+	if format == formatLibrsync {
+		err = delta.WriteLibrsync(bufOut)
+	} else {
+		err = delta.Write(bufOut)
+	}
+	if err != nil {
+		return err
+	}
+	if err := bufOut.Flush(); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+type commandSignatureDir struct {
+	baseDirPath          string
+	signatureArchivePath string
+	blockLength          uint32
+	sigOpts              []librsync.SignatureOption
+}
+
+func (c *commandSignatureDir) execute(ctx context.Context) error {
+	out, err := createOutput(ctx, c.signatureArchivePath)
 	if err != nil {
 		return err
 	}
-	out, err := os.Create(c.outFilePath)
+	defer out.Close()
+	if err := tree.WriteSignatureContext(ctx, c.baseDirPath, out, c.blockLength, c.sigOpts...); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+type commandDeltaDir struct {
+	signatureArchivePath string
+	srcDirPath           string
+	deltaArchivePath     string
+	compression          librsync.Compression
+	encoding             librsync.Encoding
+}
+
+func (c *commandDeltaDir) execute(ctx context.Context) error {
+	sigFile, err := openInput(c.signatureArchivePath)
+	if err != nil {
+		return err
+	}
+	defer sigFile.Close()
+	out, err := createOutput(ctx, c.deltaArchivePath)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
-	return delta.Patch(base, out)
+	if err := tree.WriteDeltaContext(ctx, sigFile, c.srcDirPath, out, librsync.WithCompression(c.compression), librsync.WithEncoding(c.encoding)); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+type commandPatchDir struct {
+	baseDirPath      string
+	deltaArchivePath string
+	outDirPath       string
+}
+
+func (c *commandPatchDir) execute(ctx context.Context) error {
+	deltaFile, err := openInput(c.deltaArchivePath)
+	if err != nil {
+		return err
+	}
+	defer deltaFile.Close()
+	cleanup, err := newDirCleanup(c.outDirPath)
+	if err != nil {
+		return err
+	}
+	if err := tree.PatchContext(ctx, c.baseDirPath, deltaFile, c.outDirPath); err != nil {
+		cleanup.remove()
+		return err
+	}
+	return nil
+}
+
+type commandServe struct {
+	dirPath     string
+	listenAddr  string
+	compression librsync.Compression
+	encoding    librsync.Encoding
+}
+
+func (c *commandServe) execute(ctx context.Context) error {
+	l, err := net.Listen("tcp", c.listenAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	server := netsync.NewServer(c.dirPath, librsync.WithCompression(c.compression), librsync.WithEncoding(c.encoding))
+	server.ErrorLog = func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if err := server.ServeContext(ctx, l); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+type commandPull struct {
+	addr          string
+	remotePath    string
+	localFilePath string
+	blockLength   uint32
+	sigOpts       []librsync.SignatureOption
+}
+
+func (c *commandPull) execute(ctx context.Context) error {
+	return netsync.PullContext(ctx, c.addr, c.remotePath, c.localFilePath, c.blockLength, c.sigOpts...)
 }
 
 type commandHelp struct{}
 
-func (c *commandHelp) execute() error {
+func (c *commandHelp) execute(ctx context.Context) error {
 	fmt.Println(helpMsg)
 	return nil
 }
 
-func parseCmd() (command, error) {
-	blockSize := flag.Int("block-size", 2<<10, "size of the block in bytes")
-	flag.Parse()
-	values := flag.Args()
+func parseCmd(args []string) (command, error) {
+	flags := flag.NewFlagSet("rdiff", flag.ExitOnError)
+	blockSize := flags.Int("block-size", 0, "size of the block in bytes, 0 for automatic")
+	format := flags.String("format", formatNative, "file format: native or librsync")
+	hashName := flags.String("hash", "", "strong hash algorithm")
+	sumSize := flags.Uint("sum-size", 0, "strong hash length in bytes")
+	rollingHashName := flags.String("rolling-hash", "", "rolling hash algorithm")
+	compress := flags.Bool("compress", false, "compress literal data in the delta")
+	jobs := flags.Int("jobs", 1, "number of signature hashing workers")
+	chunking := flags.String("chunking", chunkingFixed, "block chunking: fixed or cdc")
+	minChunk := flags.Int("min-chunk", cdc.DefaultParams.MinSize, "minimum content-defined chunk size in bytes")
+	avgChunk := flags.Int("avg-chunk", cdc.DefaultParams.AvgSize, "average content-defined chunk size in bytes")
+	maxChunk := flags.Int("max-chunk", cdc.DefaultParams.MaxSize, "maximum content-defined chunk size in bytes")
+	jsonOutput := flags.Bool("json", false, "print info reports as JSON")
+	inPlace := flags.Bool("inplace", false, "patch basis-file in place")
+	listenAddr := flags.String("listen", ":7811", "address for serve to listen on")
+	selfCopies := flags.Bool("self-copies", false, "reuse content repeated within new-file in the delta")
+	compact := flags.Bool("compact", false, "use variable-length chunk headers in the delta")
+	progress := flags.Bool("progress", false, "show progress on stderr")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	values := flags.Args()
 	if len(values) == 0 {
 		return nil, errors.New("no command specified")
 	}
+	if *format != formatNative && *format != formatLibrsync {
+		return nil, fmt.Errorf("invalid format: %s", *format)
+	}
+	if *blockSize < 0 {
+		return nil, fmt.Errorf("invalid block size: %d", *blockSize)
+	}
+	if *chunking != chunkingFixed && *chunking != chunkingCDC {
+		return nil, fmt.Errorf("invalid chunking: %s", *chunking)
+	}
+	compression := librsync.CompressionNone
+	if *compress {
+		if *format == formatLibrsync {
+			return nil, errors.New("compression is not supported by librsync format")
+		}
+		compression = librsync.CompressionDeflate
+	}
+	encoding := librsync.EncodingFixed
+	if *compact {
+		if *format == formatLibrsync {
+			return nil, errors.New("compact encoding is not supported by librsync format")
+		}
+		encoding = librsync.EncodingCompact
+	}
+	sigOpts := []librsync.SignatureOption{librsync.WithStrongLength(uint32(*sumSize))}
+	if *hashName != "" {
+		strongHash, err := librsync.ParseStrongHash(*hashName)
+		if err != nil {
+			return nil, err
+		}
+		sigOpts = append(sigOpts, librsync.WithStrongHash(strongHash))
+	}
+	if *rollingHashName != "" {
+		rollingHash, err := librsync.ParseRollingHash(*rollingHashName)
+		if err != nil {
+			return nil, err
+		}
+		sigOpts = append(sigOpts, librsync.WithRollingHash(rollingHash))
+	}
+	if *chunking == chunkingCDC && *format == formatLibrsync {
+		return nil, errors.New("content-defined chunking is not supported by librsync format")
+	}
 	switch values[0] {
 	case signatureCmd:
 		if len(values) != 3 {
 			return nil, errors.New("invalid signature command")
 		}
-		return &commandSignature{
+		if *jobs != 1 && *format == formatLibrsync {
+			return nil, errors.New("parallel signatures are not supported by librsync format")
+		}
+		cmd := &commandSignature{
 			baseFilePath:      values[1],
 			signatureFilePath: values[2],
 			blockLength:       uint32(*blockSize),
-		}, nil
+			format:            *format,
+			sigOpts:           sigOpts,
+			jobs:              *jobs,
+			progress:          *progress,
+		}
+		if *chunking == chunkingCDC {
+			if *jobs != 1 || *rollingHashName != "" {
+				return nil, errors.New("--jobs and --rolling-hash cannot be used with content-defined chunking")
+			}
+			params := cdc.Params{MinSize: *minChunk, AvgSize: *avgChunk, MaxSize: *maxChunk}
+			if err := params.Validate(); err != nil {
+				return nil, err
+			}
+			cmd.cdcParams = &params
+		}
+		return cmd, nil
 	case deltaCmd:
 		if len(values) != 4 {
 			return nil, errors.New("invalid delta command")
 		}
-		return &commandDelta{
+		if values[1] == stdStream && values[2] == stdStream {
+			return nil, errors.New("signature-file and new-file cannot both be read from stdin")
+		}
+		cmd := &commandDelta{
 			signatureFilePath: values[1],
 			srcFilePath:       values[2],
 			deltaFilePath:     values[3],
-		}, nil
+			format:            *format,
+			compression:       compression,
+			encoding:          encoding,
+			chunking:          *chunking,
+			progress:          *progress,
+		}
+		if *selfCopies {
+			if *format == formatLibrsync || *chunking == chunkingCDC {
+				return nil, errors.New("--self-copies is only supported by native format with fixed chunking")
+			}
+			cmd.selfCopyWindow = librsync.DefaultSelfCopyWindow
+		}
+		return cmd, nil
 	case patchCmd:
-		if len(values) != 4 {
+		wantArgs := 4
+		if *inPlace {
+			wantArgs = 3
+		}
+		if len(values) != wantArgs {
 			return nil, errors.New("invalid patch command")
 		}
+		if values[1] == stdStream {
+			return nil, errors.New("basis-file must be seekable and cannot be read from stdin")
+		}
+		if *inPlace {
+			if *progress {
+				return nil, errors.New("--progress cannot be used with --inplace")
+			}
+			return &commandPatchInPlace{
+				baseFilePath:  values[1],
+				deltaFilePath: values[2],
+				format:        *format,
+			}, nil
+		}
 		return &commandPatch{
 			baseFilePath:  values[1],
 			deltaFilePath: values[2],
 			outFilePath:   values[3],
+			format:        *format,
+			progress:      *progress,
+		}, nil
+	case invertCmd:
+		if len(values) != 4 {
+			return nil, errors.New("invalid invert command")
+		}
+		if values[1] == stdStream {
+			return nil, errors.New("basis-file must be seekable and cannot be read from stdin")
+		}
+		return &commandInvert{
+			baseFilePath:         values[1],
+			deltaFilePath:        values[2],
+			reverseDeltaFilePath: values[3],
+			format:               *format,
+		}, nil
+	case composeCmd:
+		if len(values) != 4 {
+			return nil, errors.New("invalid compose command")
+		}
+		if values[1] == stdStream && values[2] == stdStream {
+			return nil, errors.New("first-delta-file and second-delta-file cannot both be read from stdin")
+		}
+		return &commandCompose{
+			firstDeltaFilePath:    values[1],
+			secondDeltaFilePath:   values[2],
+			composedDeltaFilePath: values[3],
+			format:                *format,
+		}, nil
+	case infoCmd:
+		if len(values) != 2 {
+			return nil, errors.New("invalid info command")
+		}
+		return &commandInfo{
+			deltaFilePath: values[1],
+			format:        *format,
+			json:          *jsonOutput,
+		}, nil
+	case sigInfoCmd:
+		if len(values) != 2 {
+			return nil, errors.New("invalid sig-info command")
+		}
+		return &commandSigInfo{
+			signatureFilePath: values[1],
+			format:            *format,
+			json:              *jsonOutput,
+		}, nil
+	case sigDiffCmd:
+		if len(values) != 3 {
+			return nil, errors.New("invalid sig-diff command")
+		}
+		if values[1] == stdStream && values[2] == stdStream {
+			return nil, errors.New("first-signature-file and second-signature-file cannot both be read from stdin")
+		}
+		return &commandSigDiff{
+			firstSignatureFilePath:  values[1],
+			secondSignatureFilePath: values[2],
+			format:                  *format,
+			json:                    *jsonOutput,
+		}, nil
+	case signatureDirCmd, deltaDirCmd, patchDirCmd:
+		return parseDirCmd(values, *format, uint32(*blockSize), sigOpts, compression, encoding)
+	case serveCmd:
+		if len(values) != 2 || *format == formatLibrsync {
+			return nil, errors.New("invalid serve command")
+		}
+		return &commandServe{
+			dirPath:     values[1],
+			listenAddr:  *listenAddr,
+			compression: compression,
+			encoding:    encoding,
+		}, nil
+	case pullCmd:
+		if len(values) != 4 || values[3] == stdStream || *format == formatLibrsync {
+			return nil, errors.New("invalid pull command")
+		}
+		return &commandPull{
+			addr:          values[1],
+			remotePath:    values[2],
+			localFilePath: values[3],
+			blockLength:   uint32(*blockSize),
+			sigOpts:       sigOpts,
 		}, nil
 	case helpCmd:
 		return &commandHelp{}, nil
@@ -164,15 +723,64 @@ func parseCmd() (command, error) {
 	}
 }
 
+func parseDirCmd(values []string, format string, blockLength uint32, sigOpts []librsync.SignatureOption, compression librsync.Compression, encoding librsync.Encoding) (command, error) {
+	if format == formatLibrsync {
+		return nil, fmt.Errorf("%s is not supported by librsync format", values[0])
+	}
+	switch values[0] {
+	case signatureDirCmd:
+		if len(values) != 3 || values[1] == stdStream {
+			return nil, errors.New("invalid signature-dir command")
+		}
+		return &commandSignatureDir{
+			baseDirPath:          values[1],
+			signatureArchivePath: values[2],
+			blockLength:          blockLength,
+			sigOpts:              sigOpts,
+		}, nil
+	case deltaDirCmd:
+		if len(values) != 4 || values[2] == stdStream {
+			return nil, errors.New("invalid delta-dir command")
+		}
+		return &commandDeltaDir{
+			signatureArchivePath: values[1],
+			srcDirPath:           values[2],
+			deltaArchivePath:     values[3],
+			compression:          compression,
+			encoding:             encoding,
+		}, nil
+	default:
+		if len(values) != 4 || values[1] == stdStream || values[3] == stdStream {
+			return nil, errors.New("invalid patch-dir command")
+		}
+		return &commandPatchDir{
+			baseDirPath:      values[1],
+			deltaArchivePath: values[2],
+			outDirPath:       values[3],
+		}, nil
+	}
+}
+
 func main() {
-	cmd, err := parseCmd()
+	cmd, err := parseCmd(os.Args[1:])
 	if err != nil {
-		fmt.Println(err)
-		fmt.Println(helpMsg)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, helpMsg)
 		os.Exit(1)
 	}
-	if err := cmd.execute(); err != nil {
-		fmt.Println(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err = cmd.execute(ctx)
+	stop()
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigDiff(t *testing.T) {
+	giveOld := make([]byte, 3<<20)
+	rand.New(rand.NewSource(1)).Read(giveOld)
+	giveNew := append(bytes.Repeat([]byte{1}, 100), giveOld[:2<<20]...)
+
+	tests := []struct {
+		desc       string
+		giveFlags  []string
+		wantErrMsg string
+	}{
+		{desc: "should point to --block-size when block sizes differ", wantErrMsg: "same --block-size"},
+		{desc: "should compare signatures with shared block size", giveFlags: []string{"--block-size", "4096"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			oldPath, newPath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+			assert.NoError(t, ioutil.WriteFile(oldPath, giveOld, 0600))
+			assert.NoError(t, ioutil.WriteFile(newPath, giveNew, 0600))
+			runCmd(t, append(tc.giveFlags, "signature", oldPath, oldPath+".sig")...)
+			runCmd(t, append(tc.giveFlags, "signature", newPath, newPath+".sig")...)
+
+			cmd, err := parseCmd([]string{"sig-diff", oldPath + ".sig", newPath + ".sig"})
+			assert.NoError(t, err)
+			err = cmd.execute(context.Background())
+			if tc.wantErrMsg != "" {
+				assert.Contains(t, err.Error(), tc.wantErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPatchDirCleanup(t *testing.T) {
+	tests := []struct {
+		desc        string
+		giveOutDir  func(dir string) string
+		wantEntries []string
+	}{
+		{
+			desc:       "should remove created directories",
+			giveOutDir: func(dir string) string { return filepath.Join(dir, "parent", "out") },
+		},
+		{
+			desc: "should keep existing empty directory",
+			giveOutDir: func(dir string) string {
+				out := filepath.Join(dir, "out")
+				assert.NoError(t, os.Mkdir(out, 0700))
+				return out
+			},
+			wantEntries: []string{},
+		},
+		{
+			desc: "should keep entries of non-empty directory",
+			giveOutDir: func(dir string) string {
+				out := filepath.Join(dir, "out")
+				assert.NoError(t, os.Mkdir(out, 0700))
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(out, "keep"), []byte("keep"), 0600))
+				return out
+			},
+			wantEntries: []string{"keep"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+			assert.NoError(t, os.MkdirAll(filepath.Join(newDir, "sub"), 0755))
+			assert.NoError(t, os.Mkdir(oldDir, 0755))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(newDir, "sub", "file"), bytes.Repeat([]byte("data"), 1000), 0644))
+			sigPath, deltaPath := filepath.Join(dir, "sig"), filepath.Join(dir, "delta")
+			runCmd(t, "signature-dir", oldDir, sigPath)
+			runCmd(t, "delta-dir", sigPath, newDir, deltaPath)
+			delta, err := ioutil.ReadFile(deltaPath)
+			assert.NoError(t, err)
+			assert.NoError(t, ioutil.WriteFile(deltaPath, delta[:len(delta)-10], 0600))
+			outDir := tc.giveOutDir(dir)
+
+			cmd, err := parseCmd([]string{"patch-dir", oldDir, deltaPath, outDir})
+			assert.NoError(t, err)
+			assert.Error(t, cmd.execute(context.Background()))
+			entries, err := ioutil.ReadDir(outDir)
+			if tc.wantEntries == nil {
+				assert.True(t, os.IsNotExist(err))
+				_, err = os.Stat(filepath.Join(dir, "parent"))
+				assert.True(t, os.IsNotExist(err))
+				return
+			}
+			assert.NoError(t, err)
+			gotEntries := []string{}
+			for _, e := range entries {
+				gotEntries = append(gotEntries, e.Name())
+			}
+			assert.Equal(t, tc.wantEntries, gotEntries)
+		})
+	}
+}
+
+func runCmd(t *testing.T, args ...string) {
+	t.Helper()
+	cmd, err := parseCmd(args)
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.execute(context.Background()))
+}
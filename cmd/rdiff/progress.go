@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+const progressRefresh = 200 * time.Millisecond
+
+type progressDisplay struct {
+	out      io.Writer
+	total    int64
+	output   bool
+	start    time.Time
+	rendered time.Time
+	progress librsync.Progress
+}
+
+func newProgressDisplay(out io.Writer, total int64) *progressDisplay {
+	return &progressDisplay{out: out, total: total, start: time.Now()}
+}
+
+func newOutputProgressDisplay(out io.Writer) *progressDisplay {
+	d := newProgressDisplay(out, -1)
+	d.output = true
+	return d
+}
+
+func (d *progressDisplay) update(progress librsync.Progress) {
+	d.progress = progress
+	if now := time.Now(); now.Sub(d.rendered) >= progressRefresh {
+		d.rendered = now
+		d.render(now)
+	}
+}
+
+func (d *progressDisplay) finish() {
+	d.render(time.Now())
+	fmt.Fprintln(d.out)
+}
+
+func (d *progressDisplay) render(now time.Time) {
+	processed, label := d.progress.Offset, "read"
+	if d.output {
+		label = "written"
+	}
+	elapsed := now.Sub(d.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(processed) / elapsed.Seconds()
+	}
+	line := fmt.Sprintf("%s %s, %s/s", formatBytes(float64(processed)), label, formatBytes(rate))
+	if d.progress.BytesMatched+d.progress.LiteralBytes > 0 {
+		line += fmt.Sprintf(", %s matched, %s literal", formatBytes(float64(d.progress.BytesMatched)), formatBytes(float64(d.progress.LiteralBytes)))
+	}
+	if d.total > 0 {
+		line += fmt.Sprintf(", %.1f%%", 100*float64(processed)/float64(d.total))
+		if processed > 0 && uint64(d.total) > processed {
+			eta := time.Duration(float64(elapsed) * float64(uint64(d.total)-processed) / float64(processed))
+			line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprintf(d.out, "\r%s\x1b[K", line)
+}
+
+func formatBytes(n float64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
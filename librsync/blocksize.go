@@ -0,0 +1,26 @@
+package librsync
+
+import "math"
+
+const (
+	DefaultBlockLength uint32 = 2 << 10
+
+	minAutoBlockLength   uint32 = 256
+	maxAutoBlockLength   uint32 = 128 << 10
+	autoBlockLengthAlign uint32 = 64
+)
+
+func AutoBlockLength(size int64) uint32 {
+	if size < 0 {
+		return DefaultBlockLength
+	}
+	blockLen := uint32(math.Ceil(math.Sqrt(float64(size))))
+	blockLen = (blockLen + autoBlockLengthAlign - 1) / autoBlockLengthAlign * autoBlockLengthAlign
+	if blockLen < minAutoBlockLength {
+		return minAutoBlockLength
+	}
+	if blockLen > maxAutoBlockLength {
+		return maxAutoBlockLength
+	}
+	return blockLen
+}
@@ -0,0 +1,29 @@
+package librsync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoBlockLength(t *testing.T) {
+	tests := []struct {
+		desc         string
+		giveSize     int64
+		wantBlockLen uint32
+	}{
+		{desc: "should use default for unknown size", giveSize: -1, wantBlockLen: DefaultBlockLength},
+		{desc: "should clamp empty file", giveSize: 0, wantBlockLen: 256},
+		{desc: "should clamp small file", giveSize: 10 << 10, wantBlockLen: 256},
+		{desc: "should use square root", giveSize: 1 << 20, wantBlockLen: 1024},
+		{desc: "should round up to alignment", giveSize: 1<<20 + 1, wantBlockLen: 1088},
+		{desc: "should handle large file", giveSize: 1 << 32, wantBlockLen: 64 << 10},
+		{desc: "should clamp huge file", giveSize: 1 << 40, wantBlockLen: 128 << 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.wantBlockLen, AutoBlockLength(tc.giveSize))
+		})
+	}
+}
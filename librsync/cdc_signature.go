@@ -0,0 +1,149 @@
+package librsync
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Pirellik/simple-rdiff/cdc"
+)
+
+type CDCSignature struct {
+	params             cdc.Params
+	strongLength       uint32
+	strongHash         StrongHash
+	chunks             []cdcChunk
+	strongSigsToChunks map[string][]int
+}
+
+type cdcChunk struct {
+	offset    uint64
+	length    uint32
+	strongSig []byte
+}
+
+func NewCDCSignature(in io.Reader, params cdc.Params, opts ...SignatureOption) (*CDCSignature, error) {
+	options, err := newSignatureOptions(SHA256, Rollsum, opts)
+	if err != nil {
+		return nil, err
+	}
+	if options.strongLength != options.strongHash.Size() {
+		return nil, fmt.Errorf("truncated strong hash is not supported with content-defined chunking, got = %d, want = %d", options.strongLength, options.strongHash.Size())
+	}
+	sig := &CDCSignature{
+		params:             params,
+		strongLength:       options.strongLength,
+		strongHash:         options.strongHash,
+		strongSigsToChunks: map[string][]int{},
+	}
+	chunker, err := cdc.NewChunker(in, params)
+	if err != nil {
+		return nil, err
+	}
+	progress := newProgressTracker(options.progress)
+	for {
+		block, err := chunker.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		sig.addChunk(uint32(len(block)), sig.computeStrongChecksum(block))
+		progress.scanned(len(block))
+	}
+	progress.done()
+	return sig, nil
+}
+
+func ReadCDCSignature(in io.Reader) (*CDCSignature, error) {
+	header, err := readCDCSignatureHeader(in)
+	if err != nil {
+		return nil, err
+	}
+	sig := &CDCSignature{
+		params: cdc.Params{
+			MinSize: int(header.MinSize),
+			AvgSize: int(header.AvgSize),
+			MaxSize: int(header.MaxSize),
+		},
+		strongLength:       uint32(header.StrongLength),
+		strongHash:         StrongHash(header.StrongHash),
+		strongSigsToChunks: map[string][]int{},
+	}
+	for {
+		var length uint32
+		if err := binary.Read(in, binary.BigEndian, &length); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("truncated signature - incomplete length of chunk %d", len(sig.chunks))
+			}
+			return nil, err
+		}
+		if length == 0 || length > header.MaxSize {
+			return nil, fmt.Errorf("corrupted signature - invalid length of chunk %d = %d, max = %d", len(sig.chunks), length, header.MaxSize)
+		}
+		strongSig := make([]byte, sig.strongLength)
+		n, err := io.ReadFull(in, strongSig)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		if n != int(sig.strongLength) {
+			return nil, fmt.Errorf("too short strong hash, got = %d, want = %d", n, sig.strongLength)
+		}
+		sig.addChunk(length, strongSig)
+	}
+	return sig, nil
+}
+
+func (s *CDCSignature) Write(out io.Writer) error {
+	header := cdcSignatureHeader{
+		Magic:        cdcSignatureMagic,
+		Version:      cdcSignatureFormatVersion,
+		StrongHash:   uint8(s.strongHash),
+		StrongLength: uint8(s.strongLength),
+		MinSize:      uint32(s.params.MinSize),
+		AvgSize:      uint32(s.params.AvgSize),
+		MaxSize:      uint32(s.params.MaxSize),
+	}
+	if err := binary.Write(out, binary.BigEndian, header); err != nil {
+		return err
+	}
+	for _, c := range s.chunks {
+		if err := binary.Write(out, binary.BigEndian, c.length); err != nil {
+			return err
+		}
+		if _, err := out.Write(c.strongSig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CDCSignature) addChunk(length uint32, strongSig []byte) {
+	offset := uint64(0)
+	if len(s.chunks) > 0 {
+		last := s.chunks[len(s.chunks)-1]
+		offset = last.offset + uint64(last.length)
+	}
+	key := string(strongSig)
+	s.strongSigsToChunks[key] = append(s.strongSigsToChunks[key], len(s.chunks))
+	s.chunks = append(s.chunks, cdcChunk{offset: offset, length: length, strongSig: strongSig})
+}
+
+func (s *CDCSignature) findChunk(block []byte) (cdcChunk, bool) {
+	for _, id := range s.strongSigsToChunks[string(s.computeStrongChecksum(block))] {
+		if s.chunks[id].length == uint32(len(block)) {
+			return s.chunks[id], true
+		}
+	}
+	return cdcChunk{}, false
+}
+
+func (s *CDCSignature) computeStrongChecksum(in []byte) []byte {
+	strongHash := s.strongHash.new()
+	strongHash.Write(in)
+	return strongHash.Sum(nil)[:s.strongLength]
+}
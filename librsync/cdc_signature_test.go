@@ -0,0 +1,134 @@
+package librsync
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/Pirellik/simple-rdiff/cdc"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCDCParams = cdc.Params{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+
+func TestCDCSignatureRoundTrip(t *testing.T) {
+	giveData := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(giveData)
+
+	tests := []struct {
+		desc     string
+		giveOpts []SignatureOption
+		wantErr  bool
+	}{
+		{desc: "should use default strong hash"},
+		{desc: "should use custom strong hash", giveOpts: []SignatureOption{WithStrongHash(BLAKE2b)}},
+		{desc: "should accept full strong hash length", giveOpts: []SignatureOption{WithStrongHash(MD4), WithStrongLength(16)}},
+		{desc: "should reject truncated strong hash", giveOpts: []SignatureOption{WithStrongHash(BLAKE2b), WithStrongLength(12)}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewCDCSignature(bytes.NewReader(giveData), testCDCParams, tc.giveOpts...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			total := uint64(0)
+			for _, c := range sig.chunks {
+				assert.Equal(t, total, c.offset)
+				assert.Len(t, c.strongSig, int(sig.strongLength))
+				total += uint64(c.length)
+			}
+			assert.Equal(t, uint64(len(giveData)), total)
+
+			sigBuff := &bytes.Buffer{}
+			assert.NoError(t, sig.Write(sigBuff))
+			gotSig, err := ReadCDCSignature(sigBuff)
+			assert.NoError(t, err)
+			assert.Equal(t, sig, gotSig)
+		})
+	}
+}
+
+func TestCDCDeltaRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	giveBase := make([]byte, 200000)
+	rnd.Read(giveBase)
+	tests := []struct {
+		desc            string
+		giveNew         []byte
+		wantMaxLiterals int
+	}{
+		{desc: "should handle no changes", giveNew: giveBase, wantMaxLiterals: 0},
+		{desc: "should handle insertion", giveNew: concat(giveBase[:50000], []byte("inserted"), giveBase[50000:]), wantMaxLiterals: 2 * testCDCParams.MaxSize},
+		{desc: "should handle deletion", giveNew: concat(giveBase[:50000], giveBase[50100:]), wantMaxLiterals: 2 * testCDCParams.MaxSize},
+		{desc: "should handle empty input", giveNew: nil, wantMaxLiterals: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewCDCSignature(bytes.NewReader(giveBase), testCDCParams)
+			assert.NoError(t, err)
+
+			delta, err := NewCDCDelta(bytes.NewReader(tc.giveNew), sig)
+			assert.NoError(t, err)
+			literals := 0
+			for _, c := range delta.chunks {
+				if m, ok := c.(*modified); ok {
+					literals += len(m.data)
+				}
+			}
+			assert.LessOrEqual(t, literals, tc.wantMaxLiterals)
+
+			deltaBuff := &bytes.Buffer{}
+			assert.NoError(t, WriteCDCDelta(bytes.NewReader(tc.giveNew), sig, deltaBuff))
+			gotDelta, err := ReadDelta(bytes.NewReader(deltaBuff.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t, delta, gotDelta)
+
+			out := &bytes.Buffer{}
+			assert.NoError(t, ApplyPatch(bytes.NewReader(giveBase), deltaBuff, out))
+			assert.Equal(t, tc.giveNew, out.Bytes())
+		})
+	}
+}
+
+func TestReadCDCSignatureErrors(t *testing.T) {
+	sig, err := NewCDCSignature(bytes.NewReader(bytes.Repeat([]byte("abcdefgh"), 1000)), testCDCParams)
+	assert.NoError(t, err)
+	sigBuff := &bytes.Buffer{}
+	assert.NoError(t, sig.Write(sigBuff))
+	valid := sigBuff.Bytes()
+
+	tests := []struct {
+		desc      string
+		giveInput []byte
+	}{
+		{desc: "should reject fixed block signature", giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 0, 0, 0, 8, 0}},
+		{desc: "should reject truncated header", giveInput: valid[:10]},
+		{desc: "should reject truncated chunk length", giveInput: valid[:len(valid)-sha256Size()-2]},
+		{desc: "should reject truncated strong hash", giveInput: valid[:len(valid)-1]},
+		{desc: "should reject truncated strong hash length", giveInput: concat(valid[:6], []byte{16}, valid[7:])},
+		{desc: "should reject invalid chunk sizes", giveInput: concat(valid[:7], []byte{0, 0, 0x10, 0}, valid[11:])},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadCDCSignature(bytes.NewReader(tc.giveInput))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func sha256Size() int {
+	return int(SHA256.Size())
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
@@ -1,9 +1,12 @@
 package librsync
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 )
 
 type chunkType byte
@@ -11,13 +14,16 @@ type chunkType byte
 const (
 	chunkTypeReusable chunkType = iota
 	chunkTypeModified
+	chunkTypeSelfCopy
+
+	chunkTypeEnd chunkType = 0xff
 )
 
 type chunk interface {
 	chunkType() chunkType
-	append(chunk)
-	write(io.Writer) error
-	patch(io.ReadSeeker, io.Writer) error
+	append(chunk) bool
+	size() uint64
+	patch(io.ReadSeeker, io.Writer, *outputHistory) error
 }
 
 type reusable struct {
@@ -29,92 +35,254 @@ type modified struct {
 	data []byte
 }
 
+type selfCopy struct {
+	startPosition uint64
+	length        uint64
+}
+
 func (r *reusable) chunkType() chunkType { return chunkTypeReusable }
 func (m *modified) chunkType() chunkType { return chunkTypeModified }
+func (c *selfCopy) chunkType() chunkType { return chunkTypeSelfCopy }
+
+func (r *reusable) size() uint64 { return r.length }
+func (m *modified) size() uint64 { return uint64(len(m.data)) }
+func (c *selfCopy) size() uint64 { return c.length }
 
-func (r *reusable) append(c chunk) {
-	casted := c.(*reusable)
+func (r *reusable) append(c chunk) bool {
+	casted, ok := c.(*reusable)
+	if !ok || r.startPosition+r.length != casted.startPosition {
+		return false
+	}
 	r.length += casted.length
+	return true
 }
 
-func (m *modified) append(c chunk) {
-	casted := c.(*modified)
+func (m *modified) append(c chunk) bool {
+	casted, ok := c.(*modified)
+	if !ok {
+		return false
+	}
 	m.data = append(m.data, casted.data...)
+	return true
 }
 
-func (r *reusable) write(out io.Writer) error {
-	if err := binary.Write(out, binary.BigEndian, r.chunkType()); err != nil {
-		return err
+func (c *selfCopy) append(other chunk) bool {
+	casted, ok := other.(*selfCopy)
+	if !ok || c.startPosition+c.length != casted.startPosition {
+		return false
 	}
-	if err := binary.Write(out, binary.BigEndian, r.startPosition); err != nil {
-		return err
-	}
-	if err := binary.Write(out, binary.BigEndian, r.length); err != nil {
-		return err
-	}
-	return nil
+	c.length += casted.length
+	return true
 }
 
-func (m *modified) write(out io.Writer) error {
-	if err := binary.Write(out, binary.BigEndian, m.chunkType()); err != nil {
+func writeCopy(out io.Writer, cType chunkType, startPosition, length uint64) error {
+	if err := binary.Write(out, binary.BigEndian, cType); err != nil {
 		return err
 	}
-	if err := binary.Write(out, binary.BigEndian, uint64(len(m.data))); err != nil {
+	if err := binary.Write(out, binary.BigEndian, startPosition); err != nil {
 		return err
 	}
-	if err := binary.Write(out, binary.BigEndian, m.data); err != nil {
+	if err := binary.Write(out, binary.BigEndian, length); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *reusable) patch(base io.ReadSeeker, out io.Writer) error {
+func (r *reusable) patch(base io.ReadSeeker, out io.Writer, history *outputHistory) error {
 	if _, err := base.Seek(int64(r.startPosition), io.SeekStart); err != nil {
 		return err
 	}
-	_, err := io.CopyN(out, base, int64(r.length))
+	n, err := io.CopyN(out, base, int64(r.length))
+	if err == io.EOF {
+		return fmt.Errorf("basis too short - copied %d of %d bytes at offset %d: %w", n, r.length, r.startPosition, io.ErrUnexpectedEOF)
+	}
 	return err
 }
 
-func (m *modified) patch(base io.ReadSeeker, out io.Writer) error {
+func (m *modified) patch(base io.ReadSeeker, out io.Writer, history *outputHistory) error {
 	_, err := out.Write(m.data)
 	return err
 }
 
-func readChunk(in io.Reader) (chunk, error) {
-	var cType chunkType
-	if err := binary.Read(in, binary.BigEndian, &cType); err != nil {
-		return nil, err
+func (c *selfCopy) patch(base io.ReadSeeker, out io.Writer, history *outputHistory) error {
+	if history == nil {
+		return fmt.Errorf("corrupted chunk - self copy in delta without self copy window")
+	}
+	return history.copy(out, c.startPosition, c.length)
+}
+
+type chunkHeader struct {
+	cType         chunkType
+	startPosition uint64
+	length        uint64
+}
+
+func writeChunk(out io.Writer, codec chunkCodec, c chunk, compression Compression) error {
+	m, ok := c.(*modified)
+	if !ok {
+		return codec.writeHeader(out, c)
 	}
-	switch cType {
+	data, err := compression.compress(m.data)
+	if err != nil {
+		return err
+	}
+	if err := codec.writeHeader(out, &modified{data: data}); err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func (h *chunkHeader) readChunk(in io.Reader, compression Compression, limit *literalLimit) (chunk, error) {
+	switch h.cType {
 	case chunkTypeReusable:
-		var startPosition uint64
-		if err := binary.Read(in, binary.BigEndian, &startPosition); err != nil {
-			return nil, err
-		}
-		var length uint64
-		if err := binary.Read(in, binary.BigEndian, &length); err != nil {
-			return nil, err
-		}
 		return &reusable{
-			startPosition: startPosition,
-			length:        length,
+			startPosition: h.startPosition,
+			length:        h.length,
 		}, nil
-	case chunkTypeModified:
-		var length uint64
-		if err := binary.Read(in, binary.BigEndian, &length); err != nil {
-			return nil, err
+	case chunkTypeSelfCopy:
+		return &selfCopy{
+			startPosition: h.startPosition,
+			length:        h.length,
+		}, nil
+	default:
+		payloadLimit := limit
+		if compression != CompressionNone {
+			payloadLimit = nil
 		}
-		data := make([]byte, length)
-		n, err := in.Read(data)
+		data, err := readLiteral(in, h.length, payloadLimit)
 		if err != nil {
 			return nil, err
 		}
-		if uint64(n) != length {
-			return nil, fmt.Errorf("corrupted chunk - length mismatch, got = %d, want = %d", n, length)
+		if compression != CompressionNone {
+			r := compression.newReader(bytes.NewReader(data))
+			defer r.Close()
+			if data, err = limit.readAll(r); err != nil {
+				return nil, fmt.Errorf("corrupted chunk - %s: %w", compression, err)
+			}
 		}
+		limit.consume(len(data))
 		return &modified{data: data}, nil
+	}
+}
+
+type literalLimit struct {
+	remaining int64
+}
+
+func (l *literalLimit) check(length uint64) error {
+	if l != nil && length > uint64(l.remaining) {
+		return fmt.Errorf("%w, got = %d, remaining = %d", ErrLiteralLimit, length, l.remaining)
+	}
+	return nil
+}
+
+func (l *literalLimit) consume(n int) {
+	if l != nil {
+		l.remaining -= int64(n)
+	}
+}
+
+func (l *literalLimit) readAll(in io.Reader) ([]byte, error) {
+	if l == nil {
+		return ioutil.ReadAll(in)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(in, l.remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := l.check(uint64(len(data))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readLiteral(in io.Reader, length uint64, limit *literalLimit) ([]byte, error) {
+	if err := limit.check(length); err != nil {
+		return nil, err
+	}
+	if length > math.MaxInt64 {
+		return nil, fmt.Errorf("corrupted chunk - invalid literal length = %d", length)
+	}
+	buff := &bytes.Buffer{}
+	n, err := io.CopyN(buff, in, int64(length))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if uint64(n) != length {
+		return nil, fmt.Errorf("corrupted chunk - length mismatch, got = %d, want = %d", n, length)
+	}
+	return buff.Bytes(), nil
+}
+
+func readChunkHeader(in io.Reader) (*chunkHeader, error) {
+	header := chunkHeader{}
+	if err := binary.Read(in, binary.BigEndian, &header.cType); err != nil {
+		return nil, err
+	}
+	switch header.cType {
+	case chunkTypeReusable, chunkTypeSelfCopy:
+		if err := binary.Read(in, binary.BigEndian, &header.startPosition); err != nil {
+			return nil, truncatedChunkError(err)
+		}
+		if err := binary.Read(in, binary.BigEndian, &header.length); err != nil {
+			return nil, truncatedChunkError(err)
+		}
+	case chunkTypeModified:
+		if err := binary.Read(in, binary.BigEndian, &header.length); err != nil {
+			return nil, truncatedChunkError(err)
+		}
+	case chunkTypeEnd:
 	default:
-		return nil, fmt.Errorf("corrupted chunk - unknown type = %x", cType)
+		return nil, fmt.Errorf("corrupted chunk - unknown type = %x", header.cType)
+	}
+	if err := header.check(); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (h *chunkHeader) check() error {
+	if h.length > math.MaxInt64 {
+		return fmt.Errorf("corrupted chunk - invalid length = %d", h.length)
+	}
+	if h.startPosition > math.MaxInt64-h.length {
+		return fmt.Errorf("corrupted chunk - invalid range, offset = %d, length = %d", h.startPosition, h.length)
 	}
+	return nil
+}
+
+func (h *chunkHeader) patch(base io.ReadSeeker, in io.Reader, out io.Writer, history *outputHistory, compression Compression) error {
+	switch h.cType {
+	case chunkTypeReusable:
+		r := reusable{startPosition: h.startPosition, length: h.length}
+		return r.patch(base, out, history)
+	case chunkTypeSelfCopy:
+		c := selfCopy{startPosition: h.startPosition, length: h.length}
+		return c.patch(base, out, history)
+	}
+	if compression == CompressionNone {
+		n, err := io.CopyN(out, in, int64(h.length))
+		if err == io.EOF {
+			return fmt.Errorf("corrupted chunk - length mismatch, got = %d, want = %d", n, h.length)
+		}
+		return err
+	}
+	payload := &io.LimitedReader{R: in, N: int64(h.length)}
+	r := compression.newReader(payload)
+	defer r.Close()
+	if _, err := io.Copy(out, r); err != nil {
+		return fmt.Errorf("corrupted chunk - %s: %w", compression, err)
+	}
+	if payload.N != 0 {
+		return fmt.Errorf("corrupted chunk - %d trailing bytes after %s data", payload.N, compression)
+	}
+	return nil
+}
+
+func truncatedChunkError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("corrupted chunk - truncated header: %w", io.ErrUnexpectedEOF)
+	}
+	return err
 }
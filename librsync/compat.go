@@ -0,0 +1,308 @@
+package librsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	rsMD4SigMagic      uint32 = 0x72730136
+	rsBLAKE2SigMagic   uint32 = 0x72730137
+	rsRKMD4SigMagic    uint32 = 0x72730146
+	rsRKBLAKE2SigMagic uint32 = 0x72730147
+	rsDeltaMagic       uint32 = 0x72730236
+
+	rsOpEnd       byte = 0x00
+	rsOpLiteral1  byte = 0x01
+	rsOpLiteral64 byte = 0x40
+	rsOpLiteralN1 byte = 0x41
+	rsOpLiteralN8 byte = 0x44
+	rsOpCopyN1N1  byte = 0x45
+	rsOpCopyN8N8  byte = 0x54
+)
+
+func ReadLibrsyncSignature(in io.Reader) (*Signature, error) {
+	var header struct {
+		Magic        uint32
+		BlockLength  uint32
+		StrongLength uint32
+	}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	sig := &Signature{
+		blockLength:  header.BlockLength,
+		strongLength: header.StrongLength,
+	}
+	switch header.Magic {
+	case rsMD4SigMagic:
+		sig.strongHash, sig.weakHash = MD4, RollsumLibrsync
+	case rsBLAKE2SigMagic:
+		sig.strongHash, sig.weakHash = BLAKE2b, RollsumLibrsync
+	case rsRKMD4SigMagic:
+		sig.strongHash, sig.weakHash = MD4, RabinKarp
+	case rsRKBLAKE2SigMagic:
+		sig.strongHash, sig.weakHash = BLAKE2b, RabinKarp
+	default:
+		return nil, fmt.Errorf("unsupported librsync signature magic = %#x", header.Magic)
+	}
+	if sig.blockLength == 0 {
+		return nil, fmt.Errorf("invalid block size = %d", sig.blockLength)
+	}
+	if sig.strongLength == 0 || sig.strongLength > sig.strongHash.Size() {
+		return nil, fmt.Errorf("invalid strong hash length = %d, max length = %d", sig.strongLength, sig.strongHash.Size())
+	}
+	if err := sig.readBlocks(in); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *Signature) WriteLibrsync(out io.Writer) error {
+	var magic uint32
+	switch {
+	case s.strongHash == MD4 && s.weakHash == RollsumLibrsync:
+		magic = rsMD4SigMagic
+	case s.strongHash == BLAKE2b && s.weakHash == RollsumLibrsync:
+		magic = rsBLAKE2SigMagic
+	case s.strongHash == MD4 && s.weakHash == RabinKarp:
+		magic = rsRKMD4SigMagic
+	case s.strongHash == BLAKE2b && s.weakHash == RabinKarp:
+		magic = rsRKBLAKE2SigMagic
+	default:
+		return fmt.Errorf("signature hashes are not supported by librsync")
+	}
+	for _, v := range []uint32{magic, s.blockLength, s.strongLength} {
+		if err := binary.Write(out, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return s.writeBlocks(out)
+}
+
+func ReadLibrsyncDelta(in io.Reader, opts ...ReadOption) (*Delta, error) {
+	limit := newReadOptions(opts).newLimit()
+	if err := readLibrsyncDeltaMagic(in); err != nil {
+		return nil, err
+	}
+	delta := Delta{}
+	for {
+		header, err := readLibrsyncChunkHeader(in)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return &delta, nil
+		}
+		if header.cType == chunkTypeReusable {
+			delta.chunks = append(delta.chunks, &reusable{
+				startPosition: header.startPosition,
+				length:        header.length,
+			})
+			continue
+		}
+		c, err := readLibrsyncLiteral(in, header.length, limit)
+		if err != nil {
+			return nil, err
+		}
+		delta.chunks = append(delta.chunks, c)
+	}
+}
+
+func ApplyLibrsyncPatch(base io.ReadSeeker, delta io.Reader, out io.Writer, opts ...PatchOption) error {
+	progress := newProgressTracker(newPatchOptions(opts).progress)
+	in := bufio.NewReader(newProgressReader(delta, progress))
+	if err := readLibrsyncDeltaMagic(in); err != nil {
+		return err
+	}
+	bufOut := bufio.NewWriter(out)
+	progressOut := &progressWriter{out: bufOut, tracker: progress}
+	for {
+		header, err := readLibrsyncChunkHeader(in)
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			progress.done()
+			return bufOut.Flush()
+		}
+		progressOut.matching = header.cType != chunkTypeModified
+		if err := header.patch(base, in, progressOut, nil, CompressionNone); err != nil {
+			return err
+		}
+	}
+}
+
+func readLibrsyncDeltaMagic(in io.Reader) error {
+	var magic uint32
+	if err := binary.Read(in, binary.BigEndian, &magic); err != nil {
+		return err
+	}
+	if magic != rsDeltaMagic {
+		return fmt.Errorf("unsupported librsync delta magic = %#x", magic)
+	}
+	return nil
+}
+
+func readLibrsyncChunkHeader(in io.Reader) (*chunkHeader, error) {
+	var op byte
+	if err := binary.Read(in, binary.BigEndian, &op); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("corrupted librsync delta - missing end command: %w", io.ErrUnexpectedEOF)
+		}
+		return nil, err
+	}
+	switch {
+	case op == rsOpEnd:
+		return nil, nil
+	case op >= rsOpLiteral1 && op <= rsOpLiteral64:
+		return &chunkHeader{cType: chunkTypeModified, length: uint64(op)}, nil
+	case op >= rsOpLiteralN1 && op <= rsOpLiteralN8:
+		length, err := readLibrsyncInt(in, 1<<(op-rsOpLiteralN1))
+		if err != nil {
+			return nil, err
+		}
+		return &chunkHeader{cType: chunkTypeModified, length: length}, nil
+	case op >= rsOpCopyN1N1 && op <= rsOpCopyN8N8:
+		startPosition, err := readLibrsyncInt(in, 1<<((op-rsOpCopyN1N1)/4))
+		if err != nil {
+			return nil, err
+		}
+		length, err := readLibrsyncInt(in, 1<<((op-rsOpCopyN1N1)%4))
+		if err != nil {
+			return nil, err
+		}
+		return &chunkHeader{cType: chunkTypeReusable, startPosition: startPosition, length: length}, nil
+	default:
+		return nil, fmt.Errorf("corrupted librsync delta - unknown opcode = %#x", op)
+	}
+}
+
+func (d *Delta) WriteLibrsync(out io.Writer) error {
+	resolved, err := d.withoutSelfCopies()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.BigEndian, rsDeltaMagic); err != nil {
+		return err
+	}
+	for _, c := range resolved.chunks {
+		if err := writeLibrsyncChunk(out, c); err != nil {
+			return err
+		}
+	}
+	_, err = out.Write([]byte{rsOpEnd})
+	return err
+}
+
+func WriteLibrsyncDelta(in io.Reader, s *Signature, out io.Writer, opts ...DeltaOption) error {
+	options := newDeltaOptions(opts)
+	if options.compression != CompressionNone {
+		return fmt.Errorf("compression is not supported by librsync")
+	}
+	if options.selfCopyWindow != 0 {
+		return fmt.Errorf("self copies are not supported by librsync")
+	}
+	bufOut := bufio.NewWriter(out)
+	if err := binary.Write(bufOut, binary.BigEndian, rsDeltaMagic); err != nil {
+		return err
+	}
+	encoder := newDeltaEncoder(options, func(c chunk) error {
+		return writeLibrsyncChunk(bufOut, c)
+	})
+	if err := encoder.encode(in, s); err != nil {
+		return err
+	}
+	encoder.progress.done()
+	if _, err := bufOut.Write([]byte{rsOpEnd}); err != nil {
+		return err
+	}
+	return bufOut.Flush()
+}
+
+func writeLibrsyncChunk(out io.Writer, c chunk) error {
+	switch c := c.(type) {
+	case *reusable:
+		return writeLibrsyncCopy(out, c)
+	case *modified:
+		return writeLibrsyncLiteral(out, c)
+	default:
+		return fmt.Errorf("chunk type %d is not supported by librsync", c.chunkType())
+	}
+}
+
+func writeLibrsyncCopy(out io.Writer, r *reusable) error {
+	if r.length == 0 {
+		return nil
+	}
+	positionSize, positionIdx := librsyncIntSize(r.startPosition)
+	lengthSize, lengthIdx := librsyncIntSize(r.length)
+	if _, err := out.Write([]byte{rsOpCopyN1N1 + positionIdx*4 + lengthIdx}); err != nil {
+		return err
+	}
+	if err := writeLibrsyncInt(out, r.startPosition, positionSize); err != nil {
+		return err
+	}
+	return writeLibrsyncInt(out, r.length, lengthSize)
+}
+
+func writeLibrsyncLiteral(out io.Writer, m *modified) error {
+	length := uint64(len(m.data))
+	if length == 0 {
+		return nil
+	}
+	if length <= uint64(rsOpLiteral64) {
+		if _, err := out.Write([]byte{byte(length)}); err != nil {
+			return err
+		}
+	} else {
+		lengthSize, lengthIdx := librsyncIntSize(length)
+		if _, err := out.Write([]byte{rsOpLiteralN1 + lengthIdx}); err != nil {
+			return err
+		}
+		if err := writeLibrsyncInt(out, length, lengthSize); err != nil {
+			return err
+		}
+	}
+	_, err := out.Write(m.data)
+	return err
+}
+
+func readLibrsyncLiteral(in io.Reader, length uint64, limit *literalLimit) (*modified, error) {
+	data, err := readLiteral(in, length, limit)
+	if err != nil {
+		return nil, err
+	}
+	limit.consume(len(data))
+	return &modified{data: data}, nil
+}
+
+func librsyncIntSize(v uint64) (size int, idx byte) {
+	switch {
+	case v <= 0xff:
+		return 1, 0
+	case v <= 0xffff:
+		return 2, 1
+	case v <= 0xffffffff:
+		return 4, 2
+	default:
+		return 8, 3
+	}
+}
+
+func writeLibrsyncInt(out io.Writer, v uint64, size int) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	_, err := out.Write(buf[8-size:])
+	return err
+}
+
+func readLibrsyncInt(in io.Reader, size int) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(in, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
@@ -0,0 +1,224 @@
+package librsync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLibrsyncDeltaWrite(t *testing.T) {
+	literal := bytes.Repeat([]byte{7}, 100)
+	giveDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 0, length: 32},
+			&modified{data: []byte{19}},
+			&reusable{startPosition: 32, length: 34},
+			&reusable{startPosition: 0x1234, length: 0x100000},
+			&modified{data: literal},
+		},
+	}
+	wantBuff := bytes.NewBuffer([]byte{0x72, 0x73, 0x02, 0x36, 0x45, 0, 32, 0x01, 19, 0x45, 32, 34, 0x4b, 0x12, 0x34, 0, 0x10, 0, 0, 0x41, 100})
+	wantBuff.Write(literal)
+	wantBuff.WriteByte(0)
+
+	gotBuff := &bytes.Buffer{}
+	err := giveDelta.WriteLibrsync(gotBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, wantBuff, gotBuff)
+}
+
+func TestReadLibrsyncDelta(t *testing.T) {
+	literal := bytes.Repeat([]byte{7}, 100)
+	giveBuff := bytes.NewBuffer([]byte{0x72, 0x73, 0x02, 0x36, 0x45, 0, 32, 0x01, 19, 0x45, 32, 34, 0x4b, 0x12, 0x34, 0, 0x10, 0, 0, 0x41, 100})
+	giveBuff.Write(literal)
+	giveBuff.WriteByte(0)
+	wantDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 0, length: 32},
+			&modified{data: []byte{19}},
+			&reusable{startPosition: 32, length: 34},
+			&reusable{startPosition: 0x1234, length: 0x100000},
+			&modified{data: literal},
+		},
+	}
+
+	gotDelta, err := ReadLibrsyncDelta(giveBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, wantDelta, gotDelta)
+}
+
+func TestReadLibrsyncDeltaErrors(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveInput []byte
+	}{
+		{desc: "should reject wrong magic", giveInput: []byte{0x72, 0x73, 0x01, 0x36, 0}},
+		{desc: "should reject unknown opcode", giveInput: []byte{0x72, 0x73, 0x02, 0x36, 0x55}},
+		{desc: "should reject truncated literal", giveInput: []byte{0x72, 0x73, 0x02, 0x36, 0x03, 1}},
+		{desc: "should reject missing end", giveInput: []byte{0x72, 0x73, 0x02, 0x36, 0x01, 1}},
+		{desc: "should reject huge literal length", giveInput: []byte{0x72, 0x73, 0x02, 0x36, 0x44, 0x40, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadLibrsyncDelta(bytes.NewBuffer(tc.giveInput))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLibrsyncSignatureRoundTrip(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+
+	sig, err := NewLibrsyncSignature(bytes.NewReader(giveBase), 16)
+	assert.NoError(t, err)
+	buff := &bytes.Buffer{}
+	assert.NoError(t, sig.WriteLibrsync(buff))
+	assert.Equal(t, []byte{0x72, 0x73, 0x01, 0x37, 0, 0, 0, 16, 0, 0, 0, 32}, buff.Bytes()[:12])
+	assert.Equal(t, 12+6*(4+32), buff.Len())
+
+	gotSig, err := ReadLibrsyncSignature(buff)
+	assert.NoError(t, err)
+	assert.Equal(t, sig, gotSig)
+}
+
+func TestLibrsyncPatchRoundTrip(t *testing.T) {
+	giveBase := bytes.Repeat([]byte("hello world "), 20)
+	giveNew := append(append([]byte("prefix "), giveBase[:100]...), giveBase[130:]...)
+
+	sig, err := NewLibrsyncSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	delta, err := NewDelta(bytes.NewReader(giveNew), sig)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.WriteLibrsync(deltaBuff))
+
+	gotDelta, err := ReadLibrsyncDelta(deltaBuff)
+	assert.NoError(t, err)
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, gotDelta.Patch(bytes.NewReader(giveBase), gotBuff))
+	assert.Equal(t, giveNew, gotBuff.Bytes())
+}
+
+func TestWriteLibrsyncDelta(t *testing.T) {
+	giveBase := bytes.Repeat([]byte("hello world "), 20)
+	giveNew := append(append([]byte("prefix "), giveBase[:100]...), giveBase[130:]...)
+
+	sig, err := NewLibrsyncSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	delta, err := NewDelta(bytes.NewReader(giveNew), sig)
+	assert.NoError(t, err)
+	wantBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.WriteLibrsync(wantBuff))
+
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteLibrsyncDelta(bytes.NewReader(giveNew), sig, gotBuff))
+	assert.Equal(t, wantBuff, gotBuff)
+}
+
+func TestApplyLibrsyncPatch(t *testing.T) {
+	giveBase := bytes.Repeat([]byte("hello world "), 20)
+	giveNew := append(append([]byte("prefix "), giveBase[:100]...), giveBase[130:]...)
+
+	sig, err := NewLibrsyncSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteLibrsyncDelta(bytes.NewReader(giveNew), sig, deltaBuff))
+
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, ApplyLibrsyncPatch(bytes.NewReader(giveBase), deltaBuff, gotBuff))
+	assert.Equal(t, giveNew, gotBuff.Bytes())
+}
+
+func TestLibrsyncRabinKarpSignature(t *testing.T) {
+	giveBase := bytes.Repeat([]byte("hello world "), 20)
+	giveNew := append(append([]byte("prefix "), giveBase[:100]...), giveBase[130:]...)
+
+	sig, err := NewLibrsyncSignature(bytes.NewReader(giveBase), 8, WithRollingHash(RabinKarp), WithStrongHash(MD4))
+	assert.NoError(t, err)
+	sigBuff := &bytes.Buffer{}
+	assert.NoError(t, sig.WriteLibrsync(sigBuff))
+	assert.Equal(t, []byte{0x72, 0x73, 0x01, 0x46, 0, 0, 0, 8, 0, 0, 0, 16}, sigBuff.Bytes()[:12])
+
+	gotSig, err := ReadLibrsyncSignature(sigBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, RabinKarp, gotSig.weakHash)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteLibrsyncDelta(bytes.NewReader(giveNew), gotSig, deltaBuff))
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, ApplyLibrsyncPatch(bytes.NewReader(giveBase), deltaBuff, gotBuff))
+	assert.Equal(t, giveNew, gotBuff.Bytes())
+
+	_, err = NewLibrsyncSignature(bytes.NewReader(giveBase), 8, WithRollingHash(Gear))
+	assert.Error(t, err)
+}
+
+func TestLibrsyncGoldenSignatures(t *testing.T) {
+	base := readGolden(t, "base.txt")
+	giveNew := readGolden(t, "new.txt")
+
+	tests := []struct {
+		desc       string
+		giveFile   string
+		wantStrong StrongHash
+		wantWeak   RollingHash
+	}{
+		{desc: "should read md4 rollsum signature", giveFile: "base.md4.rollsum.sig", wantStrong: MD4, wantWeak: RollsumLibrsync},
+		{desc: "should read blake2 rollsum signature", giveFile: "base.blake2.rollsum.sig", wantStrong: BLAKE2b, wantWeak: RollsumLibrsync},
+		{desc: "should read md4 rabinkarp signature", giveFile: "base.md4.rabinkarp.sig", wantStrong: MD4, wantWeak: RabinKarp},
+		{desc: "should read blake2 rabinkarp signature", giveFile: "base.blake2.rabinkarp.sig", wantStrong: BLAKE2b, wantWeak: RabinKarp},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			golden := readGolden(t, tc.giveFile)
+			gotSig, err := ReadLibrsyncSignature(bytes.NewReader(golden))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantStrong, gotSig.strongHash)
+			assert.Equal(t, tc.wantWeak, gotSig.weakHash)
+			assert.Equal(t, uint32(64), gotSig.blockLength)
+			assert.Equal(t, uint32(8), gotSig.strongLength)
+
+			sig, err := NewLibrsyncSignature(bytes.NewReader(base), 64, WithStrongHash(tc.wantStrong), WithRollingHash(tc.wantWeak), WithStrongLength(8))
+			assert.NoError(t, err)
+			sigBuff := &bytes.Buffer{}
+			assert.NoError(t, sig.WriteLibrsync(sigBuff))
+			assert.Equal(t, golden, sigBuff.Bytes())
+
+			deltaBuff := &bytes.Buffer{}
+			assert.NoError(t, WriteLibrsyncDelta(bytes.NewReader(giveNew), gotSig, deltaBuff))
+			assert.Less(t, deltaBuff.Len(), len(giveNew)/2)
+			gotBuff := &bytes.Buffer{}
+			assert.NoError(t, ApplyLibrsyncPatch(bytes.NewReader(base), deltaBuff, gotBuff))
+			assert.Equal(t, giveNew, gotBuff.Bytes())
+		})
+	}
+}
+
+func TestApplyLibrsyncGoldenDelta(t *testing.T) {
+	base := readGolden(t, "base.txt")
+	wantNew := readGolden(t, "new.txt")
+
+	gotBuff := &bytes.Buffer{}
+	err := ApplyLibrsyncPatch(bytes.NewReader(base), bytes.NewReader(readGolden(t, "base-new.delta")), gotBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, wantNew, gotBuff.Bytes())
+
+	delta, err := ReadLibrsyncDelta(bytes.NewReader(readGolden(t, "base-new.delta")))
+	assert.NoError(t, err)
+	gotBuff.Reset()
+	assert.NoError(t, delta.Patch(bytes.NewReader(base), gotBuff))
+	assert.Equal(t, wantNew, gotBuff.Bytes())
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "librsync", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,60 @@
+package librsync
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+func Compose(d1, d2 *Delta) (*Delta, error) {
+	d1, err := d1.withoutSelfCopies()
+	if err != nil {
+		return nil, err
+	}
+	offsets := d1.outputOffsets()
+	size := offsets[len(offsets)-1]
+	composed := Delta{compression: d2.compression, checksum: d2.checksum, selfWindow: d2.selfWindow, encoding: d2.encoding}
+	for _, c := range d2.chunks {
+		var r *reusable
+		switch c := c.(type) {
+		case *reusable:
+			r = c
+		case *modified:
+			composed.addChunk(&modified{data: append([]byte(nil), c.data...)})
+			continue
+		case *selfCopy:
+			composed.addChunk(&selfCopy{startPosition: c.startPosition, length: c.length})
+			continue
+		}
+		if r.startPosition+r.length > size {
+			return nil, fmt.Errorf("intermediate file too short - delta copies %d bytes at offset %d, file size = %d: %w", r.length, r.startPosition, size, io.ErrUnexpectedEOF)
+		}
+		position, end := r.startPosition, r.startPosition+r.length
+		i := sort.Search(len(offsets)-1, func(i int) bool { return offsets[i+1] > position })
+		for ; position < end; i++ {
+			skip := position - offsets[i]
+			length := offsets[i+1] - position
+			if length > end-position {
+				length = end - position
+			}
+			switch c := d1.chunks[i].(type) {
+			case *reusable:
+				composed.addChunk(&reusable{startPosition: c.startPosition + skip, length: length})
+			case *modified:
+				data := make([]byte, length)
+				copy(data, c.data[skip:])
+				composed.addChunk(&modified{data: data})
+			}
+			position += length
+		}
+	}
+	return &composed, nil
+}
+
+func (d *Delta) outputOffsets() []uint64 {
+	offsets := make([]uint64, 1, len(d.chunks)+1)
+	for _, c := range d.chunks {
+		offsets = append(offsets, offsets[len(offsets)-1]+c.size())
+	}
+	return offsets
+}
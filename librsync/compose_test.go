@@ -0,0 +1,86 @@
+package librsync
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompose(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveV1 := make([]byte, 10000)
+	rnd.Read(giveV1)
+	tests := []struct {
+		desc   string
+		giveV2 []byte
+		giveV3 []byte
+	}{
+		{desc: "should handle no changes", giveV2: giveV1, giveV3: giveV1},
+		{desc: "should handle independent edits", giveV2: concat(giveV1[:1000], []byte("first"), giveV1[1000:]), giveV3: concat(giveV1[:1000], []byte("first"), giveV1[1000:7000], []byte("second"), giveV1[7000:])},
+		{desc: "should handle overwritten literal", giveV2: concat(giveV1[:5000], []byte("literal data"), giveV1[5000:]), giveV3: concat(giveV1[:5000], []byte("literal"), giveV1[5000:])},
+		{desc: "should handle reordering", giveV2: concat(giveV1[5000:], giveV1[:5000]), giveV3: concat(giveV1[2500:7500], []byte("tail"))},
+		{desc: "should handle empty intermediate file", giveV2: nil, giveV3: []byte("fresh content")},
+		{desc: "should handle empty final file", giveV2: giveV1[:3000], giveV3: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig1, err := NewSignature(bytes.NewReader(giveV1), 64)
+			assert.NoError(t, err)
+			d1, err := NewDelta(bytes.NewReader(tc.giveV2), sig1)
+			assert.NoError(t, err)
+			sig2, err := NewSignature(bytes.NewReader(tc.giveV2), 64)
+			assert.NoError(t, err)
+			d2, err := NewDelta(bytes.NewReader(tc.giveV3), sig2)
+			assert.NoError(t, err)
+
+			composed, err := Compose(d1, d2)
+			assert.NoError(t, err)
+			out := &bytes.Buffer{}
+			assert.NoError(t, composed.Patch(bytes.NewReader(giveV1), out))
+			assert.Equal(t, string(tc.giveV3), out.String())
+		})
+	}
+}
+
+func TestComposeChunks(t *testing.T) {
+	giveD1 := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 100, length: 10},
+			&modified{data: []byte("abcdef")},
+			&reusable{startPosition: 0, length: 10},
+		},
+	}
+	giveD2 := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 5, length: 8},
+			&modified{data: []byte("xyz")},
+			&reusable{startPosition: 14, length: 4},
+		},
+		checksum: checksumOf([]byte("content")),
+	}
+	wantDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 105, length: 5},
+			&modified{data: []byte("abcxyzef")},
+			&reusable{startPosition: 0, length: 2},
+		},
+		checksum: checksumOf([]byte("content")),
+	}
+
+	gotDelta, err := Compose(giveD1, giveD2)
+	assert.NoError(t, err)
+	assert.Equal(t, wantDelta, gotDelta)
+	assert.Equal(t, []byte("xyz"), giveD2.chunks[1].(*modified).data)
+}
+
+func TestComposeIntermediateTooShort(t *testing.T) {
+	giveD1 := &Delta{chunks: []chunk{&modified{data: []byte("short")}}}
+	giveD2 := &Delta{chunks: []chunk{&reusable{startPosition: 2, length: 10}}}
+
+	_, err := Compose(giveD1, giveD2)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,57 @@
+package librsync
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionDeflate
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone:    "none",
+	CompressionDeflate: "deflate",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+func (c Compression) valid() bool {
+	_, ok := compressionNames[c]
+	return ok
+}
+
+func (c Compression) compress(data []byte) ([]byte, error) {
+	if c == CompressionNone {
+		return data, nil
+	}
+	buff := &bytes.Buffer{}
+	w, err := flate.NewWriter(buff, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+func (c Compression) newReader(in io.Reader) io.ReadCloser {
+	if c == CompressionNone {
+		return io.NopCloser(in)
+	}
+	return flate.NewReader(in)
+}
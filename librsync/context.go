@@ -0,0 +1,103 @@
+package librsync
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/Pirellik/simple-rdiff/cdc"
+)
+
+type contextReader struct {
+	ctx context.Context
+	in  io.Reader
+}
+
+type contextWriter struct {
+	ctx context.Context
+	out io.Writer
+}
+
+type contextReaderAt struct {
+	ctx context.Context
+	in  io.ReaderAt
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	default:
+		return r.in.Read(p)
+	}
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.ctx.Done():
+		return 0, w.ctx.Err()
+	default:
+		return w.out.Write(p)
+	}
+}
+
+func (r *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	select {
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	default:
+		return r.in.ReadAt(p, off)
+	}
+}
+
+func NewSignatureContext(ctx context.Context, in io.Reader, blockLen uint32, opts ...SignatureOption) (*Signature, error) {
+	return NewSignature(&contextReader{ctx: ctx, in: in}, blockLen, opts...)
+}
+
+func NewDeltaContext(ctx context.Context, in io.Reader, s *Signature, opts ...DeltaOption) (*Delta, error) {
+	return NewDelta(&contextReader{ctx: ctx, in: in}, s, opts...)
+}
+
+func WriteDeltaContext(ctx context.Context, in io.Reader, s *Signature, out io.Writer, opts ...DeltaOption) error {
+	return WriteDelta(&contextReader{ctx: ctx, in: in}, s, out, opts...)
+}
+
+func (d *Delta) PatchContext(ctx context.Context, base io.ReadSeeker, out io.Writer, opts ...PatchOption) error {
+	return d.Patch(base, &contextWriter{ctx: ctx, out: out}, opts...)
+}
+
+func ApplyPatchContext(ctx context.Context, base io.ReadSeeker, delta io.Reader, out io.Writer, opts ...PatchOption) error {
+	return ApplyPatch(base, &contextReader{ctx: ctx, in: delta}, &contextWriter{ctx: ctx, out: out}, opts...)
+}
+
+func NewLibrsyncSignatureContext(ctx context.Context, in io.Reader, blockLen uint32, opts ...SignatureOption) (*Signature, error) {
+	return NewLibrsyncSignature(&contextReader{ctx: ctx, in: in}, blockLen, opts...)
+}
+
+func NewSignatureParallelContext(ctx context.Context, r io.ReaderAt, size int64, blockLen uint32, workers int, opts ...SignatureOption) (*Signature, error) {
+	return NewSignatureParallel(&contextReaderAt{ctx: ctx, in: r}, size, blockLen, workers, opts...)
+}
+
+func NewCDCSignatureContext(ctx context.Context, in io.Reader, params cdc.Params, opts ...SignatureOption) (*CDCSignature, error) {
+	return NewCDCSignature(&contextReader{ctx: ctx, in: in}, params, opts...)
+}
+
+func NewCDCDeltaContext(ctx context.Context, in io.Reader, s *CDCSignature, opts ...DeltaOption) (*Delta, error) {
+	return NewCDCDelta(&contextReader{ctx: ctx, in: in}, s, opts...)
+}
+
+func WriteCDCDeltaContext(ctx context.Context, in io.Reader, s *CDCSignature, out io.Writer, opts ...DeltaOption) error {
+	return WriteCDCDelta(&contextReader{ctx: ctx, in: in}, s, out, opts...)
+}
+
+func WriteLibrsyncDeltaContext(ctx context.Context, in io.Reader, s *Signature, out io.Writer, opts ...DeltaOption) error {
+	return WriteLibrsyncDelta(&contextReader{ctx: ctx, in: in}, s, out, opts...)
+}
+
+func ApplyLibrsyncPatchContext(ctx context.Context, base io.ReadSeeker, delta io.Reader, out io.Writer, opts ...PatchOption) error {
+	return ApplyLibrsyncPatch(base, &contextReader{ctx: ctx, in: delta}, &contextWriter{ctx: ctx, out: out}, opts...)
+}
+
+func (d *Delta) PatchInPlaceContext(ctx context.Context, f *os.File) error {
+	return d.patchInPlace(ctx, f)
+}
@@ -0,0 +1,201 @@
+package librsync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type cancelingReader struct {
+	*bytes.Reader
+	cancel context.CancelFunc
+	after  int64
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.count(n)
+	return n, err
+}
+
+func (r *cancelingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	r.count(n)
+	return n, err
+}
+
+func (r *cancelingReader) count(n int) {
+	if atomic.AddInt64(&r.after, -int64(n)) <= 0 {
+		r.cancel()
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 100000)
+	rnd.Read(giveOld)
+	giveNew := concat(giveOld[:30000], []byte("inserted"), giveOld[30000:])
+	sig, err := NewSignature(bytes.NewReader(giveOld), 64)
+	assert.NoError(t, err)
+	wantDelta, err := NewDelta(bytes.NewReader(giveNew), sig)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	gotSig, err := NewSignatureContext(ctx, bytes.NewReader(giveOld), 64)
+	assert.NoError(t, err)
+	assert.Equal(t, sig, gotSig)
+	gotDelta, err := NewDeltaContext(ctx, bytes.NewReader(giveNew), sig)
+	assert.NoError(t, err)
+	assert.Equal(t, wantDelta, gotDelta)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDeltaContext(ctx, bytes.NewReader(giveNew), sig, deltaBuff))
+	out := &bytes.Buffer{}
+	assert.NoError(t, ApplyPatchContext(ctx, bytes.NewReader(giveOld), deltaBuff, out))
+	assert.Equal(t, giveNew, out.Bytes())
+	out.Reset()
+	assert.NoError(t, gotDelta.PatchContext(ctx, bytes.NewReader(giveOld), out))
+	assert.Equal(t, giveNew, out.Bytes())
+}
+
+func TestContextCancellation(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 1000000)
+	rnd.Read(giveOld)
+	sig, err := NewSignature(bytes.NewReader(giveOld), 64)
+	assert.NoError(t, err)
+	librsyncSig, err := NewLibrsyncSignature(bytes.NewReader(giveOld), 64)
+	assert.NoError(t, err)
+	cdcSig, err := NewCDCSignature(bytes.NewReader(giveOld), testCDCParams)
+	assert.NoError(t, err)
+	delta, err := NewDelta(bytes.NewReader(giveOld), sig)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.Write(deltaBuff))
+	librsyncDeltaBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.WriteLibrsync(librsyncDeltaBuff))
+	tests := []struct {
+		desc string
+		give func(ctx context.Context, in *cancelingReader) error
+	}{
+		{
+			desc: "should cancel signature",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				_, err := NewSignatureContext(ctx, in, 64)
+				return err
+			},
+		},
+		{
+			desc: "should cancel librsync signature",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				_, err := NewLibrsyncSignatureContext(ctx, in, 64)
+				return err
+			},
+		},
+		{
+			desc: "should cancel parallel signature",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				_, err := NewSignatureParallelContext(ctx, in, in.Size(), 64, 4)
+				return err
+			},
+		},
+		{
+			desc: "should cancel cdc signature",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				_, err := NewCDCSignatureContext(ctx, in, testCDCParams)
+				return err
+			},
+		},
+		{
+			desc: "should cancel delta",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				_, err := NewDeltaContext(ctx, in, sig)
+				return err
+			},
+		},
+		{
+			desc: "should cancel streamed delta",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				return WriteDeltaContext(ctx, in, sig, io.Discard)
+			},
+		},
+		{
+			desc: "should cancel librsync delta",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				return WriteLibrsyncDeltaContext(ctx, in, librsyncSig, io.Discard)
+			},
+		},
+		{
+			desc: "should cancel cdc delta",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				_, err := NewCDCDeltaContext(ctx, in, cdcSig)
+				return err
+			},
+		},
+		{
+			desc: "should cancel streamed cdc delta",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				return WriteCDCDeltaContext(ctx, in, cdcSig, io.Discard)
+			},
+		},
+		{
+			desc: "should cancel patch",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				return delta.PatchContext(ctx, in, io.Discard)
+			},
+		},
+		{
+			desc: "should cancel streamed patch",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				return ApplyPatchContext(ctx, in, bytes.NewReader(deltaBuff.Bytes()), io.Discard)
+			},
+		},
+		{
+			desc: "should cancel librsync patch",
+			give: func(ctx context.Context, in *cancelingReader) error {
+				return ApplyLibrsyncPatchContext(ctx, in, bytes.NewReader(librsyncDeltaBuff.Bytes()), io.Discard)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			in := &cancelingReader{Reader: bytes.NewReader(giveOld), cancel: cancel, after: int64(len(giveOld))}
+			assert.ErrorIs(t, tc.give(ctx, in), context.Canceled)
+
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			in = &cancelingReader{Reader: bytes.NewReader(giveOld), cancel: cancel, after: int64(len(giveOld) / 2)}
+			assert.ErrorIs(t, tc.give(ctx, in), context.Canceled)
+			assert.LessOrEqual(t, atomic.LoadInt64(&in.after), int64(0))
+		})
+	}
+}
+
+func TestPatchInPlaceContext(t *testing.T) {
+	giveOld := []byte("some basis file content")
+	sig, err := NewSignature(bytes.NewReader(giveOld), 4)
+	assert.NoError(t, err)
+	delta, err := NewDelta(bytes.NewReader([]byte("changed basis file")), sig)
+	assert.NoError(t, err)
+	f := writeTempFile(t, giveOld)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, delta.PatchInPlaceContext(ctx, f), context.Canceled)
+	got, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, giveOld, got)
+
+	assert.NoError(t, delta.PatchInPlaceContext(context.Background(), f))
+	got, err = ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "changed basis file", string(got))
+}
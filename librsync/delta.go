@@ -1,85 +1,260 @@
 package librsync
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
-
-	"github.com/Pirellik/simple-rdiff/rollsum"
 )
 
+var ErrLiteralLimit = errors.New("literal data limit exceeded")
+
 type Delta struct {
-	chunks []chunk
+	chunks      []chunk
+	compression Compression
+	checksum    *fileChecksum
+	selfWindow  uint32
+	encoding    Encoding
 }
 
-func NewDelta(in io.Reader, s *Signature) (*Delta, error) {
-	delta := Delta{}
-	rSum := rollsum.New()
-	block := make([]byte, s.blockLength)
-	singleByte := make([]byte, 1)
-	prevChunkType := chunkTypeReusable
+type MatchPolicy uint8
 
-	for {
-		if prevChunkType == chunkTypeReusable {
-			n, err := in.Read(block)
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				return nil, err
-			}
-			if n < len(block) {
-				block = block[:n]
-			}
-			rSum.Init(block)
-		} else {
-			if _, err := in.Read(singleByte); err != nil {
-				if err == io.EOF {
-					delta.addChunk(&modified{data: block[1:]})
-					break
-				}
-				return nil, err
-			}
-			rSum.Roll(block[0], singleByte[0])
-			block = append(block[1:], singleByte...)
-		}
-		chunk := getChunk(block, rSum.Sum(), s)
-		delta.addChunk(chunk)
-		prevChunkType = chunk.chunkType()
+const (
+	MatchLocality MatchPolicy = iota
+	MatchLowestID
+)
+
+type DeltaOption func(*deltaOptions)
+
+type deltaOptions struct {
+	matchPolicy    MatchPolicy
+	maxLiteralSize int
+	compression    Compression
+	selfCopyWindow uint32
+	encoding       Encoding
+	progress       ProgressFunc
+}
+
+const defaultMaxLiteralSize = 1 << 16
+
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	literalLimit int64
+}
+
+func WithLiteralLimit(size int64) ReadOption {
+	return func(o *readOptions) {
+		o.literalLimit = size
+	}
+}
+
+func newReadOptions(opts []ReadOption) readOptions {
+	options := readOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func (o readOptions) newLimit() *literalLimit {
+	if o.literalLimit <= 0 {
+		return nil
+	}
+	return &literalLimit{remaining: o.literalLimit}
+}
+
+func WithMatchPolicy(policy MatchPolicy) DeltaOption {
+	return func(o *deltaOptions) {
+		o.matchPolicy = policy
+	}
+}
+
+func WithMaxLiteralSize(size int) DeltaOption {
+	return func(o *deltaOptions) {
+		o.maxLiteralSize = size
+	}
+}
+
+func WithCompression(compression Compression) DeltaOption {
+	return func(o *deltaOptions) {
+		o.compression = compression
+	}
+}
+
+func WithSelfCopyWindow(size uint32) DeltaOption {
+	return func(o *deltaOptions) {
+		o.selfCopyWindow = size
+	}
+}
+
+func WithEncoding(encoding Encoding) DeltaOption {
+	return func(o *deltaOptions) {
+		o.encoding = encoding
+	}
+}
+
+func newDeltaOptions(opts []DeltaOption) deltaOptions {
+	options := deltaOptions{maxLiteralSize: defaultMaxLiteralSize}
+	for _, opt := range opts {
+		opt(&options)
 	}
+	if options.maxLiteralSize <= 0 {
+		options.maxLiteralSize = defaultMaxLiteralSize
+	}
+	return options
+}
+
+func (o deltaOptions) validate() error {
+	if !o.compression.valid() {
+		return fmt.Errorf("unknown compression = %d", o.compression)
+	}
+	if !o.encoding.valid() {
+		return fmt.Errorf("unknown encoding = %d", o.encoding)
+	}
+	return nil
+}
+
+func NewDelta(in io.Reader, s *Signature, opts ...DeltaOption) (*Delta, error) {
+	return newDelta(opts, func(e *deltaEncoder) error {
+		return e.encode(in, s)
+	})
+}
+
+func NewCDCDelta(in io.Reader, s *CDCSignature, opts ...DeltaOption) (*Delta, error) {
+	return newDelta(opts, func(e *deltaEncoder) error {
+		return e.encodeChunks(in, s)
+	})
+}
+
+func WriteDelta(in io.Reader, s *Signature, out io.Writer, opts ...DeltaOption) error {
+	return writeDelta(out, opts, func(e *deltaEncoder) error {
+		return e.encode(in, s)
+	})
+}
+
+func WriteCDCDelta(in io.Reader, s *CDCSignature, out io.Writer, opts ...DeltaOption) error {
+	return writeDelta(out, opts, func(e *deltaEncoder) error {
+		return e.encodeChunks(in, s)
+	})
+}
+
+func newDelta(opts []DeltaOption, encode func(*deltaEncoder) error) (*Delta, error) {
+	options := newDeltaOptions(opts)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	delta := Delta{compression: options.compression, selfWindow: options.selfCopyWindow, encoding: options.encoding}
+	encoder := newDeltaEncoder(options, func(c chunk) error {
+		delta.addChunk(c)
+		return nil
+	})
+	if err := encode(encoder); err != nil {
+		return nil, err
+	}
+	encoder.progress.done()
+	delta.checksum = encoder.checksum.checksum()
 	return &delta, nil
 }
 
-func ReadDelta(in io.Reader) (*Delta, error) {
-	delta := Delta{}
+func writeDelta(out io.Writer, opts []DeltaOption, encode func(*deltaEncoder) error) error {
+	options := newDeltaOptions(opts)
+	if err := options.validate(); err != nil {
+		return err
+	}
+	bufOut := bufio.NewWriter(out)
+	if err := newDeltaHeader(options.compression, checksumHash, options.selfCopyWindow, options.encoding).write(bufOut); err != nil {
+		return err
+	}
+	codec := options.encoding.newCodec()
+	encoder := newDeltaEncoder(options, func(c chunk) error {
+		return writeChunk(bufOut, codec, c, options.compression)
+	})
+	if err := encode(encoder); err != nil {
+		return err
+	}
+	encoder.progress.done()
+	if err := writeEndRecord(bufOut, encoder.checksum.checksum()); err != nil {
+		return err
+	}
+	return bufOut.Flush()
+}
+
+func ReadDelta(in io.Reader, opts ...ReadOption) (*Delta, error) {
+	limit := newReadOptions(opts).newLimit()
+	header, err := readDeltaHeader(in)
+	if err != nil {
+		return nil, err
+	}
+	delta := Delta{compression: Compression(header.Compression), selfWindow: header.SelfWindow, encoding: header.encoding()}
+	codec := delta.encoding.newCodec()
 	for {
-		chunk, err := readChunk(in)
+		chunkHeader, err := codec.readHeader(in)
 		if err != nil {
 			if err == io.EOF {
+				if header.hasEndRecord() {
+					return nil, errMissingEndRecord
+				}
 				break
 			}
 			return nil, err
 		}
+		if chunkHeader.cType == chunkTypeEnd {
+			if delta.checksum, err = readEndRecord(in, StrongHash(header.ChecksumHash)); err != nil {
+				return nil, err
+			}
+			break
+		}
+		chunk, err := chunkHeader.readChunk(in, delta.compression, limit)
+		if err != nil {
+			return nil, err
+		}
 		delta.chunks = append(delta.chunks, chunk)
 	}
 	return &delta, nil
 }
 
-func (d *Delta) Patch(base io.ReadSeeker, out io.Writer) error {
+func (d *Delta) Patch(base io.ReadSeeker, out io.Writer, opts ...PatchOption) error {
+	progress := newProgressTracker(newPatchOptions(opts).progress)
+	progressOut := &progressWriter{out: out, tracker: progress}
+	out = progressOut
+	var checksum *checksumWriter
+	if d.checksum != nil {
+		checksum = newChecksumWriter(d.checksum.strongHash)
+		out = io.MultiWriter(out, checksum)
+	}
+	history := newOutputHistory(d.selfWindow)
+	if history != nil {
+		out = io.MultiWriter(out, history)
+	}
 	for _, c := range d.chunks {
-		if err := c.patch(base, out); err != nil {
+		progressOut.matching = c.chunkType() != chunkTypeModified
+		if err := c.patch(base, out, history); err != nil {
 			return err
 		}
 	}
+	progress.done()
+	if checksum != nil {
+		return d.checksum.verify(checksum.checksum())
+	}
 	return nil
 }
 
 func (d *Delta) Write(out io.Writer) error {
+	checksum := checksumHash
+	if d.checksum != nil {
+		checksum = d.checksum.strongHash
+	}
+	if err := newDeltaHeader(d.compression, checksum, d.selfWindow, d.encoding).write(out); err != nil {
+		return err
+	}
+	codec := d.encoding.newCodec()
 	for _, c := range d.chunks {
-		if err := c.write(out); err != nil {
+		if err := writeChunk(out, codec, c, d.compression); err != nil {
 			return err
 		}
 	}
-	return nil
+	return writeEndRecord(out, d.checksum)
 }
 
 func (d *Delta) addChunk(c chunk) {
@@ -87,22 +262,8 @@ func (d *Delta) addChunk(c chunk) {
 		d.chunks = append(d.chunks, c)
 		return
 	}
-	if d.chunks[len(d.chunks)-1].chunkType() == c.chunkType() {
-		d.chunks[len(d.chunks)-1].append(c)
+	if d.chunks[len(d.chunks)-1].append(c) {
 		return
 	}
 	d.chunks = append(d.chunks, c)
 }
-
-func getChunk(block []byte, weakSum uint32, s *Signature) chunk {
-	blockID, ok := s.weakSignaturesToBlockID[weakSum]
-	if ok && bytes.Equal(s.strongSignatures[int(blockID)], computeStrongChecksum(block)) {
-		return &reusable{
-			startPosition: blockID * uint64(len(block)),
-			length:        uint64(len(block)),
-		}
-	}
-	return &modified{
-		data: block[:1],
-	}
-}
@@ -3,6 +3,7 @@ package librsync
 import (
 	"bytes"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -20,16 +21,18 @@ func TestNewDelta(t *testing.T) {
 				101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108,
 				108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32}),
 			giveSig: &Signature{
-				blockLength: 32,
+				blockLength:  32,
+				strongLength: 32,
 				strongSignatures: [][]byte{
 					{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 					{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 					{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 				},
-				weakSignaturesToBlockID: map[uint32]uint64{
-					16646287:   2,
-					3276082140: 1,
-					3308522449: 0,
+				weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+				weakSignaturesToBlockIDs: map[uint32][]uint64{
+					16646287:   {2},
+					3276082140: {1},
+					3308522449: {0},
 				},
 			},
 			wantDelta: &Delta{
@@ -47,16 +50,18 @@ func TestNewDelta(t *testing.T) {
 				101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 102, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108,
 				108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32}),
 			giveSig: &Signature{
-				blockLength: 32,
+				blockLength:  32,
+				strongLength: 32,
 				strongSignatures: [][]byte{
 					{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 					{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 					{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 				},
-				weakSignaturesToBlockID: map[uint32]uint64{
-					16646287:   2,
-					3276082140: 1,
-					3308522449: 0,
+				weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+				weakSignaturesToBlockIDs: map[uint32][]uint64{
+					16646287:   {2},
+					3276082140: {1},
+					3308522449: {0},
 				},
 			},
 			wantDelta: &Delta{
@@ -77,16 +82,18 @@ func TestNewDelta(t *testing.T) {
 				101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 19, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108,
 				108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32}),
 			giveSig: &Signature{
-				blockLength: 32,
+				blockLength:  32,
+				strongLength: 32,
 				strongSignatures: [][]byte{
 					{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 					{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 					{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 				},
-				weakSignaturesToBlockID: map[uint32]uint64{
-					16646287:   2,
-					3276082140: 1,
-					3308522449: 0,
+				weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+				weakSignaturesToBlockIDs: map[uint32][]uint64{
+					16646287:   {2},
+					3276082140: {1},
+					3308522449: {0},
 				},
 			},
 			wantDelta: &Delta{
@@ -111,16 +118,18 @@ func TestNewDelta(t *testing.T) {
 				101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108,
 				108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32}),
 			giveSig: &Signature{
-				blockLength: 32,
+				blockLength:  32,
+				strongLength: 32,
 				strongSignatures: [][]byte{
 					{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 					{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 					{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 				},
-				weakSignaturesToBlockID: map[uint32]uint64{
-					16646287:   2,
-					3276082140: 1,
-					3308522449: 0,
+				weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+				weakSignaturesToBlockIDs: map[uint32][]uint64{
+					16646287:   {2},
+					3276082140: {1},
+					3308522449: {0},
 				},
 			},
 			wantDelta: &Delta{
@@ -139,6 +148,7 @@ func TestNewDelta(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.desc, func(t *testing.T) {
+			tc.wantDelta.checksum = checksumOf(tc.giveInput.Bytes())
 			gotDelta, err := NewDelta(tc.giveInput, tc.giveSig)
 			assert.NoError(t, err)
 			assert.Equal(t, tc.wantDelta, gotDelta)
@@ -147,7 +157,7 @@ func TestNewDelta(t *testing.T) {
 }
 
 func TestReadDelta(t *testing.T) {
-	giveBuff := bytes.NewBuffer([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 32, 1, 0, 0, 0, 0, 0, 0, 0, 1, 19, 0, 0, 0, 0, 0, 0, 0, 0, 32, 0, 0, 0, 0, 0, 0, 0, 34})
+	giveBuff := bytes.NewBuffer([]byte{0x72, 0x64, 0x64, 0x6c, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 32, 1, 0, 0, 0, 0, 0, 0, 0, 1, 19, 0, 0, 0, 0, 0, 0, 0, 0, 32, 0, 0, 0, 0, 0, 0, 0, 34})
 	wantDelta := &Delta{
 		chunks: []chunk{
 			&reusable{
@@ -169,6 +179,43 @@ func TestReadDelta(t *testing.T) {
 	assert.Equal(t, wantDelta, gotDelta)
 }
 
+func TestReadDeltaLimits(t *testing.T) {
+	hugeLiteral := &bytes.Buffer{}
+	assert.NoError(t, newDeltaHeader(CompressionNone, checksumHash, 0, EncodingFixed).write(hugeLiteral))
+	hugeLiteral.Write([]byte{byte(chunkTypeModified), 0x40, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3})
+	sig, err := NewSignature(bytes.NewReader(nil), 8)
+	assert.NoError(t, err)
+	bomb := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(make([]byte, 1<<20)), sig, bomb, WithCompression(CompressionDeflate), WithMaxLiteralSize(1<<20)))
+
+	tests := []struct {
+		desc      string
+		giveInput []byte
+		giveOpts  []ReadOption
+		wantErr   error
+	}{
+		{desc: "should reject huge literal length without limit", giveInput: hugeLiteral.Bytes()},
+		{desc: "should reject huge literal length with limit", giveInput: hugeLiteral.Bytes(), giveOpts: []ReadOption{WithLiteralLimit(1 << 20)}, wantErr: ErrLiteralLimit},
+		{desc: "should reject inflated literal over limit", giveInput: bomb.Bytes(), giveOpts: []ReadOption{WithLiteralLimit(1 << 16)}, wantErr: ErrLiteralLimit},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadDelta(bytes.NewReader(tc.giveInput), tc.giveOpts...)
+			assert.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+		})
+	}
+
+	delta, err := ReadDelta(bytes.NewReader(bomb.Bytes()), WithLiteralLimit(1<<20))
+	assert.NoError(t, err)
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.Patch(bytes.NewReader(nil), gotBuff))
+	assert.Equal(t, 1<<20, gotBuff.Len())
+}
+
 func TestDeltaWrite(t *testing.T) {
 	giveDelta := &Delta{
 		chunks: []chunk{
@@ -185,7 +232,8 @@ func TestDeltaWrite(t *testing.T) {
 			},
 		},
 	}
-	wantBuff := bytes.NewBuffer([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 32, 1, 0, 0, 0, 0, 0, 0, 0, 1, 19, 0, 0, 0, 0, 0, 0, 0, 0, 32, 0, 0, 0, 0, 0, 0, 0, 34})
+	wantBuff := bytes.NewBuffer([]byte{0x72, 0x64, 0x64, 0x6c, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 32, 1, 0, 0, 0, 0, 0, 0, 0, 1, 19, 0, 0, 0, 0, 0, 0, 0, 0, 32, 0, 0, 0, 0, 0, 0, 0, 34,
+		0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0})
 
 	gotBuff := &bytes.Buffer{}
 	err := giveDelta.Write(gotBuff)
@@ -221,3 +269,158 @@ func TestDeltaPatch(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, wantBuff, gotBuff)
 }
+
+func TestNewDeltaMatchPolicy(t *testing.T) {
+	giveBase := []byte("AAAAAAAABBBBBBBBAAAAAAAACCCCCCCC")
+	giveInput := []byte("BBBBBBBBAAAAAAAACCCCCCCC")
+	tests := []struct {
+		desc       string
+		givePolicy MatchPolicy
+		wantDelta  *Delta
+	}{
+		{
+			desc:       "should prefer the block following the previous match",
+			givePolicy: MatchLocality,
+			wantDelta: &Delta{
+				chunks: []chunk{
+					&reusable{startPosition: 8, length: 24},
+				},
+			},
+		},
+		{
+			desc:       "should prefer the lowest block ID",
+			givePolicy: MatchLowestID,
+			wantDelta: &Delta{
+				chunks: []chunk{
+					&reusable{startPosition: 8, length: 8},
+					&reusable{startPosition: 0, length: 8},
+					&reusable{startPosition: 24, length: 8},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.wantDelta.checksum = checksumOf(giveInput)
+			sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+			assert.NoError(t, err)
+			gotDelta, err := NewDelta(bytes.NewReader(giveInput), sig, WithMatchPolicy(tc.givePolicy))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDelta, gotDelta)
+		})
+	}
+}
+
+func TestNewDeltaZeroFilledBlocks(t *testing.T) {
+	giveBase := bytes.Repeat([]byte{0}, 64)
+	giveInput := append([]byte("new"), bytes.Repeat([]byte{0}, 64)...)
+	wantDelta := &Delta{
+		chunks: []chunk{
+			&modified{data: []byte("new")},
+			&reusable{startPosition: 0, length: 64},
+		},
+		checksum: checksumOf(giveInput),
+	}
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 16)
+	assert.NoError(t, err)
+	gotDelta, err := NewDelta(bytes.NewReader(giveInput), sig)
+	assert.NoError(t, err)
+	assert.Equal(t, wantDelta, gotDelta)
+}
+
+func TestWriteDelta(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	giveInput := []byte("the quick brown cat jumps over the lazy dog; a new line; pack my box with five dozen liquor jugs")
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	delta, err := NewDelta(bytes.NewReader(giveInput), sig)
+	assert.NoError(t, err)
+	wantBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.Write(wantBuff))
+
+	gotBuff := &bytes.Buffer{}
+	err = WriteDelta(bytes.NewReader(giveInput), sig, gotBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, wantBuff, gotBuff)
+}
+
+func TestWriteDeltaMaxLiteralSize(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog")
+	giveInput := append([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), giveBase...)
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	err = WriteDelta(bytes.NewReader(giveInput), sig, deltaBuff, WithMaxLiteralSize(10))
+	assert.NoError(t, err)
+
+	gotDelta, err := ReadDelta(deltaBuff)
+	assert.NoError(t, err)
+	wantDelta := &Delta{
+		chunks: []chunk{
+			&modified{data: []byte("0123456789")},
+			&modified{data: []byte("abcdefghij")},
+			&modified{data: []byte("klmnopqrst")},
+			&modified{data: []byte("uvwxyz")},
+			&reusable{startPosition: 0, length: uint64(len(giveBase))},
+		},
+		checksum: checksumOf(giveInput),
+	}
+	assert.Equal(t, wantDelta, gotDelta)
+
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, gotDelta.Patch(bytes.NewReader(giveBase), gotBuff))
+	assert.Equal(t, giveInput, gotBuff.Bytes())
+}
+
+func TestNewDeltaShortReads(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	giveInput := []byte("the quick brown cat jumps over the lazy dog; a new line; pack my box with five dozen liquor jugs")
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	wantDelta, err := NewDelta(bytes.NewReader(giveInput), sig)
+	assert.NoError(t, err)
+	gotDelta, err := NewDelta(iotest.OneByteReader(bytes.NewReader(giveInput)), sig)
+	assert.NoError(t, err)
+	assert.Equal(t, wantDelta, gotDelta)
+}
+
+func TestDeltaCompression(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog")
+	giveInput := append(bytes.Repeat([]byte("compressible literal data "), 1000), giveBase...)
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	plainBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(giveInput), sig, plainBuff))
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(giveInput), sig, deltaBuff, WithCompression(CompressionDeflate)))
+	assert.Less(t, deltaBuff.Len(), plainBuff.Len()/10)
+
+	delta, err := NewDelta(bytes.NewReader(giveInput), sig, WithCompression(CompressionDeflate))
+	assert.NoError(t, err)
+	wantBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.Write(wantBuff))
+	assert.Equal(t, wantBuff.Bytes(), deltaBuff.Bytes())
+
+	gotDelta, err := ReadDelta(bytes.NewReader(deltaBuff.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, delta, gotDelta)
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, gotDelta.Patch(bytes.NewReader(giveBase), gotBuff))
+	assert.Equal(t, giveInput, gotBuff.Bytes())
+
+	gotBuff.Reset()
+	assert.NoError(t, ApplyPatch(bytes.NewReader(giveBase), deltaBuff, gotBuff))
+	assert.Equal(t, giveInput, gotBuff.Bytes())
+}
+
+func checksumOf(data []byte) *fileChecksum {
+	checksum := newChecksumWriter(checksumHash)
+	checksum.Write(data)
+	return checksum.checksum()
+}
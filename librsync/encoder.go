@@ -0,0 +1,175 @@
+package librsync
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/Pirellik/simple-rdiff/cdc"
+)
+
+type deltaEncoder struct {
+	options     deltaOptions
+	emit        func(chunk) error
+	pending     chunk
+	literal     []byte
+	nextBlockID uint64
+	checksum    *checksumWriter
+	progress    *progressTracker
+}
+
+func newDeltaEncoder(options deltaOptions, emit func(chunk) error) *deltaEncoder {
+	return &deltaEncoder{
+		options:  options,
+		emit:     emit,
+		checksum: newChecksumWriter(checksumHash),
+		progress: newProgressTracker(options.progress),
+	}
+}
+
+func (e *deltaEncoder) encode(in io.Reader, s *Signature) error {
+	blockLen := int(s.blockLength)
+	bufIn := bufio.NewReader(io.TeeReader(newProgressReader(in, e.progress), e.checksum))
+	rSum := s.weakHash.new()
+	self := newSelfIndex(s, e.options.selfCopyWindow)
+	window := make([]byte, 2*blockLen)
+	start, end := 0, 0
+	matched := true
+
+	for {
+		if matched {
+			n, err := io.ReadFull(bufIn, window[:blockLen])
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			start, end = 0, n
+			rSum.Init(window[start:end])
+		} else {
+			b, err := bufIn.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					if err := e.addLiteral(window[start+1 : end]); err != nil {
+						return err
+					}
+					self.track(window[start+1 : end])
+					break
+				}
+				return err
+			}
+			rSum.Roll(window[start], b)
+			if end == len(window) {
+				copy(window, window[start:end])
+				end -= start
+				start = 0
+			}
+			window[end] = b
+			start++
+			end++
+		}
+		block := window[start:end]
+		blockID, ok := s.findBlock(block, rSum.Sum(), e.nextBlockID, e.options.matchPolicy)
+		var err error
+		if ok {
+			e.nextBlockID = blockID + 1
+			err = e.addCopy(&reusable{
+				startPosition: blockID * uint64(s.blockLength),
+				length:        uint64(len(block)),
+			})
+		} else if offset, found := self.find(block, rSum.Sum()); found {
+			ok = true
+			err = e.addCopy(&selfCopy{startPosition: offset, length: uint64(len(block))})
+		} else {
+			block = block[:1]
+			err = e.addLiteral(block)
+		}
+		if err != nil {
+			return err
+		}
+		self.track(block)
+		matched = ok
+	}
+	return e.flush()
+}
+
+func (e *deltaEncoder) encodeChunks(in io.Reader, s *CDCSignature) error {
+	chunker, err := cdc.NewChunker(io.TeeReader(newProgressReader(in, e.progress), e.checksum), s.params)
+	if err != nil {
+		return err
+	}
+	for {
+		block, err := chunker.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if c, ok := s.findChunk(block); ok {
+			err = e.addCopy(&reusable{startPosition: c.offset, length: uint64(c.length)})
+		} else {
+			err = e.addLiteral(block)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+func (e *deltaEncoder) addCopy(c chunk) error {
+	if err := e.flushLiteral(); err != nil {
+		return err
+	}
+	e.progress.matched(c.size())
+	if e.pending != nil && e.pending.append(c) {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.pending = c
+	return nil
+}
+
+func (e *deltaEncoder) addLiteral(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.progress.literal(uint64(len(data)))
+	e.literal = append(e.literal, data...)
+	if len(e.literal) >= e.options.maxLiteralSize {
+		return e.flushLiteral()
+	}
+	return nil
+}
+
+func (e *deltaEncoder) flushCopy() error {
+	if e.pending == nil {
+		return nil
+	}
+	pending := e.pending
+	e.pending = nil
+	return e.emit(pending)
+}
+
+func (e *deltaEncoder) flushLiteral() error {
+	if len(e.literal) == 0 {
+		return nil
+	}
+	data := make([]byte, len(e.literal))
+	copy(data, e.literal)
+	e.literal = e.literal[:0]
+	return e.emit(&modified{data: data})
+}
+
+func (e *deltaEncoder) flush() error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	return e.flushLiteral()
+}
@@ -0,0 +1,184 @@
+package librsync
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type Encoding uint8
+
+const (
+	EncodingFixed Encoding = iota
+	EncodingCompact
+)
+
+const (
+	compactOpLiteral  byte = 0x00
+	compactOpCopy     byte = 0x40
+	compactOpSelfCopy byte = 0x80
+	compactOpControl  byte = 0xc0
+
+	compactKindMask   byte = 0xc0
+	compactLengthMask byte = 0x3f
+)
+
+var encodingNames = map[Encoding]string{
+	EncodingFixed:   "fixed",
+	EncodingCompact: "compact",
+}
+
+func (e Encoding) String() string {
+	if name, ok := encodingNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Encoding(%d)", uint8(e))
+}
+
+func (e Encoding) valid() bool {
+	_, ok := encodingNames[e]
+	return ok
+}
+
+func (e Encoding) newCodec() chunkCodec {
+	if e == EncodingCompact {
+		return &compactCodec{}
+	}
+	return fixedCodec{}
+}
+
+type chunkCodec interface {
+	writeHeader(out io.Writer, c chunk) error
+	readHeader(in io.Reader) (*chunkHeader, error)
+}
+
+type fixedCodec struct{}
+
+func (fixedCodec) writeHeader(out io.Writer, c chunk) error {
+	switch c := c.(type) {
+	case *modified:
+		if err := binary.Write(out, binary.BigEndian, c.chunkType()); err != nil {
+			return err
+		}
+		return binary.Write(out, binary.BigEndian, uint64(len(c.data)))
+	case *reusable:
+		return writeCopy(out, c.chunkType(), c.startPosition, c.length)
+	case *selfCopy:
+		return writeCopy(out, c.chunkType(), c.startPosition, c.length)
+	default:
+		return fmt.Errorf("unknown chunk type = %d", c.chunkType())
+	}
+}
+
+func (fixedCodec) readHeader(in io.Reader) (*chunkHeader, error) {
+	return readChunkHeader(in)
+}
+
+type compactCodec struct {
+	copyEnd     uint64
+	selfCopyEnd uint64
+}
+
+func (e *compactCodec) writeHeader(out io.Writer, c chunk) error {
+	buffer := make([]byte, 1, 1+2*binary.MaxVarintLen64)
+	switch c := c.(type) {
+	case *modified:
+		buffer = appendCompactOp(buffer, compactOpLiteral, uint64(len(c.data)))
+	case *reusable:
+		buffer = appendCompactOp(buffer, compactOpCopy, c.length)
+		buffer = appendVarint(buffer, int64(c.startPosition-e.copyEnd))
+		e.copyEnd = c.startPosition + c.length
+	case *selfCopy:
+		buffer = appendCompactOp(buffer, compactOpSelfCopy, c.length)
+		buffer = appendVarint(buffer, int64(c.startPosition-e.selfCopyEnd))
+		e.selfCopyEnd = c.startPosition + c.length
+	default:
+		return fmt.Errorf("unknown chunk type = %d", c.chunkType())
+	}
+	_, err := out.Write(buffer)
+	return err
+}
+
+func (e *compactCodec) readHeader(in io.Reader) (*chunkHeader, error) {
+	r := newByteReader(in)
+	op, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if op == byte(chunkTypeEnd) {
+		return &chunkHeader{cType: chunkTypeEnd}, nil
+	}
+	header := chunkHeader{length: uint64(op & compactLengthMask)}
+	if op&compactKindMask == compactOpControl {
+		return nil, fmt.Errorf("corrupted chunk - unknown opcode = %#x", op)
+	}
+	if header.length == 0 {
+		if header.length, err = binary.ReadUvarint(r); err != nil {
+			return nil, truncatedChunkError(err)
+		}
+	}
+	switch op & compactKindMask {
+	case compactOpLiteral:
+		header.cType = chunkTypeModified
+	case compactOpCopy:
+		header.cType = chunkTypeReusable
+		if header.startPosition, err = readRelativePosition(r, e.copyEnd); err != nil {
+			return nil, err
+		}
+		e.copyEnd = header.startPosition + header.length
+	case compactOpSelfCopy:
+		header.cType = chunkTypeSelfCopy
+		if header.startPosition, err = readRelativePosition(r, e.selfCopyEnd); err != nil {
+			return nil, err
+		}
+		e.selfCopyEnd = header.startPosition + header.length
+	}
+	if err := header.check(); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func appendCompactOp(buffer []byte, kind byte, length uint64) []byte {
+	if length > 0 && length <= uint64(compactLengthMask) {
+		buffer[0] = kind | byte(length)
+		return buffer
+	}
+	buffer[0] = kind
+	n := len(buffer)
+	buffer = buffer[:n+binary.MaxVarintLen64]
+	return buffer[:n+binary.PutUvarint(buffer[n:], length)]
+}
+
+func appendVarint(buffer []byte, v int64) []byte {
+	n := len(buffer)
+	buffer = buffer[:n+binary.MaxVarintLen64]
+	return buffer[:n+binary.PutVarint(buffer[n:], v)]
+}
+
+func readRelativePosition(r io.ByteReader, previousEnd uint64) (uint64, error) {
+	offset, err := binary.ReadVarint(r)
+	if err != nil {
+		return 0, truncatedChunkError(err)
+	}
+	return previousEnd + uint64(offset), nil
+}
+
+type singleByteReader struct {
+	io.Reader
+}
+
+func newByteReader(in io.Reader) io.ByteReader {
+	if r, ok := in.(io.ByteReader); ok {
+		return r
+	}
+	return singleByteReader{in}
+}
+
+func (r singleByteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r.Reader, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
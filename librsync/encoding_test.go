@@ -0,0 +1,136 @@
+package librsync
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactDeltaWrite(t *testing.T) {
+	giveDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 10, length: 20},
+			&modified{data: []byte{19}},
+			&reusable{startPosition: 30, length: 64},
+			&reusable{startPosition: 0, length: 1},
+			&selfCopy{startPosition: 3, length: 2},
+		},
+		encoding: EncodingCompact,
+	}
+	wantBytes := []byte{0x72, 0x64, 0x64, 0x6c, 5, 0, 0, 0, 0, 0, 0,
+		0x54, 0x14,
+		0x01, 19,
+		0x40, 0x40, 0x00,
+		0x41, 0xbb, 0x01,
+		0x82, 0x06,
+		0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, giveDelta.Write(gotBuff))
+	assert.Equal(t, wantBytes, gotBuff.Bytes())
+
+	gotDelta, err := ReadDelta(struct{ io.Reader }{bytes.NewReader(wantBytes)})
+	assert.NoError(t, err)
+	assert.Equal(t, giveDelta, gotDelta)
+}
+
+func TestCompactDeltaRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 100000)
+	rnd.Read(giveOld)
+	giveScattered := append([]byte(nil), giveOld...)
+	for i := 100; i < len(giveScattered); i += 700 {
+		giveScattered[i]++
+	}
+	tests := []struct {
+		desc        string
+		giveNew     []byte
+		giveOpts    []DeltaOption
+		wantSmaller bool
+	}{
+		{desc: "should handle no changes", giveNew: giveOld, wantSmaller: true},
+		{desc: "should handle scattered edits", giveNew: giveScattered, wantSmaller: true},
+		{desc: "should handle moved blocks", giveNew: concat(giveOld[60000:], giveOld[:60000]), wantSmaller: true},
+		{desc: "should handle compression", giveNew: giveScattered, giveOpts: []DeltaOption{WithCompression(CompressionDeflate)}, wantSmaller: true},
+		{desc: "should handle self copies", giveNew: concat(giveOld[:5000], giveOld[:5000]), giveOpts: []DeltaOption{WithSelfCopyWindow(DefaultSelfCopyWindow)}, wantSmaller: true},
+		{desc: "should handle empty new file", giveNew: nil, wantSmaller: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(giveOld[:50000]), 256)
+			assert.NoError(t, err)
+			opts := append([]DeltaOption{WithEncoding(EncodingCompact)}, tc.giveOpts...)
+			wantDelta, err := NewDelta(bytes.NewReader(tc.giveNew), sig, opts...)
+			assert.NoError(t, err)
+			assert.Equal(t, EncodingCompact, wantDelta.Encoding())
+
+			compactBuff := &bytes.Buffer{}
+			assert.NoError(t, WriteDelta(bytes.NewReader(tc.giveNew), sig, compactBuff, opts...))
+			compactSize := compactBuff.Len()
+			gotDelta, err := ReadDelta(bytes.NewReader(compactBuff.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t, wantDelta, gotDelta)
+			out := &bytes.Buffer{}
+			assert.NoError(t, ApplyPatch(bytes.NewReader(giveOld[:50000]), compactBuff, out))
+			assert.Equal(t, string(tc.giveNew), out.String())
+
+			fixedBuff := &bytes.Buffer{}
+			assert.NoError(t, WriteDelta(bytes.NewReader(tc.giveNew), sig, fixedBuff, tc.giveOpts...))
+			assert.Equal(t, tc.wantSmaller, compactSize < fixedBuff.Len())
+		})
+	}
+}
+
+func TestCompactCodecErrors(t *testing.T) {
+	tests := []struct {
+		desc       string
+		giveInput  []byte
+		wantErr    error
+		wantErrMsg string
+	}{
+		{desc: "should reject unknown opcode", giveInput: []byte{0xc0}},
+		{desc: "should reject truncated length", giveInput: []byte{0x40, 0x80}, wantErr: io.ErrUnexpectedEOF},
+		{desc: "should reject missing offset", giveInput: []byte{0x41}, wantErr: io.ErrUnexpectedEOF},
+		{desc: "should reject truncated literal", giveInput: []byte{0x03, 1}},
+		{desc: "should reject missing end record", giveInput: []byte{0x01, 1}, wantErr: io.ErrUnexpectedEOF},
+		{
+			desc:       "should reject overflowing literal length",
+			giveInput:  []byte{0x00, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01, 0xff},
+			wantErrMsg: "corrupted chunk - invalid length",
+		},
+		{
+			desc:       "should reject overflowing copy range",
+			giveInput:  []byte{0x41, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0xff},
+			wantErrMsg: "corrupted chunk - invalid range",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			giveDelta := append([]byte{0x72, 0x64, 0x64, 0x6c, 5, 0, 0, 0, 0, 0, 0}, tc.giveInput...)
+			_, err := ReadDelta(bytes.NewReader(giveDelta))
+			assert.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+			if tc.wantErrMsg != "" && err != nil {
+				assert.Contains(t, err.Error(), tc.wantErrMsg)
+			}
+			err = ApplyPatch(bytes.NewReader(nil), bytes.NewReader(giveDelta), &bytes.Buffer{})
+			assert.Error(t, err)
+			if tc.wantErrMsg != "" && err != nil {
+				assert.Contains(t, err.Error(), tc.wantErrMsg)
+			}
+		})
+	}
+}
+
+func TestEncodingString(t *testing.T) {
+	assert.Equal(t, "fixed", EncodingFixed.String())
+	assert.Equal(t, "compact", EncodingCompact.String())
+	assert.Equal(t, "Encoding(7)", Encoding(7).String())
+}
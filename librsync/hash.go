@@ -0,0 +1,131 @@
+package librsync
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/fnv"
+
+	"github.com/Pirellik/simple-rdiff/rollsum"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/md4"
+)
+
+type StrongHash uint8
+
+const (
+	SHA256 StrongHash = iota
+	MD4
+	BLAKE2b
+	SHA512_256
+	MD5
+	FNV128
+)
+
+var strongHashNames = map[StrongHash]string{
+	SHA256:     "sha256",
+	MD4:        "md4",
+	BLAKE2b:    "blake2b",
+	SHA512_256: "sha512-256",
+	MD5:        "md5",
+	FNV128:     "fnv128",
+}
+
+func ParseStrongHash(name string) (StrongHash, error) {
+	for h, n := range strongHashNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown strong hash algorithm: %s", name)
+}
+
+func (h StrongHash) String() string {
+	if name, ok := strongHashNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("StrongHash(%d)", uint8(h))
+}
+
+func (h StrongHash) Size() uint32 {
+	return uint32(h.new().Size())
+}
+
+func (h StrongHash) valid() bool {
+	_, ok := strongHashNames[h]
+	return ok
+}
+
+func (h StrongHash) new() hash.Hash {
+	switch h {
+	case MD4:
+		return md4.New()
+	case BLAKE2b:
+		b, _ := blake2b.New256(nil)
+		return b
+	case SHA512_256:
+		return sha512.New512_256()
+	case MD5:
+		return md5.New()
+	case FNV128:
+		return fnv.New128a()
+	default:
+		return sha256.New()
+	}
+}
+
+type RollingHash uint8
+
+const (
+	Rollsum RollingHash = iota
+	RollsumLibrsync
+	RabinKarp
+	Buzhash
+	Gear
+)
+
+var rollingHashNames = map[RollingHash]string{
+	Rollsum:         "rollsum",
+	RollsumLibrsync: "rollsum-librsync",
+	RabinKarp:       "rabinkarp",
+	Buzhash:         "buzhash",
+	Gear:            "gear",
+}
+
+func ParseRollingHash(name string) (RollingHash, error) {
+	for h, n := range rollingHashNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown rolling hash algorithm: %s", name)
+}
+
+func (h RollingHash) String() string {
+	if name, ok := rollingHashNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("RollingHash(%d)", uint8(h))
+}
+
+func (h RollingHash) valid() bool {
+	_, ok := rollingHashNames[h]
+	return ok
+}
+
+func (h RollingHash) new() rollsum.RollingHash {
+	switch h {
+	case RollsumLibrsync:
+		return rollsum.NewWithCharOffset(rollsum.LibrsyncCharOffset)
+	case RabinKarp:
+		return rollsum.NewRabinKarp()
+	case Buzhash:
+		return rollsum.NewBuzhash()
+	case Gear:
+		return rollsum.NewGear()
+	default:
+		return rollsum.New()
+	}
+}
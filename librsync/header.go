@@ -0,0 +1,208 @@
+package librsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Pirellik/simple-rdiff/cdc"
+)
+
+const (
+	signatureMagic    uint32 = 0x72647367
+	deltaMagic        uint32 = 0x7264646c
+	cdcSignatureMagic uint32 = 0x72646363
+
+	signatureFormatVersion    uint8 = 1
+	deltaFormatVersion        uint8 = 5
+	cdcSignatureFormatVersion uint8 = 1
+)
+
+var (
+	ErrInvalidMagic       = errors.New("invalid magic number")
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	ErrTruncatedHeader    = errors.New("truncated header")
+)
+
+type signatureHeader struct {
+	Magic        uint32
+	Version      uint8
+	StrongHash   uint8
+	StrongLength uint8
+	WeakHash     uint8
+	BlockLength  uint32
+}
+
+type cdcSignatureHeader struct {
+	Magic        uint32
+	Version      uint8
+	StrongHash   uint8
+	StrongLength uint8
+	MinSize      uint32
+	AvgSize      uint32
+	MaxSize      uint32
+}
+
+type deltaHeader struct {
+	Magic        uint32
+	Version      uint8
+	Compression  uint8
+	ChecksumHash uint8
+	SelfWindow   uint32
+}
+
+type headerPrefix struct {
+	Magic   uint32
+	Version uint8
+}
+
+func readSignatureHeader(in io.Reader) (*signatureHeader, error) {
+	header := signatureHeader{}
+	if err := readHeader(in, &header); err != nil {
+		return nil, err
+	}
+	if err := checkMagicAndVersion(header.Magic, signatureMagic, header.Version, signatureFormatVersion); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	if !StrongHash(header.StrongHash).valid() {
+		return nil, fmt.Errorf("signature: unknown strong hash algorithm = %d", header.StrongHash)
+	}
+	if !RollingHash(header.WeakHash).valid() {
+		return nil, fmt.Errorf("signature: unknown rolling hash algorithm = %d", header.WeakHash)
+	}
+	maxStrongLength := StrongHash(header.StrongHash).Size()
+	if header.StrongLength == 0 || uint32(header.StrongLength) > maxStrongLength {
+		return nil, fmt.Errorf("signature: invalid strong hash length = %d, max length = %d", header.StrongLength, maxStrongLength)
+	}
+	if header.BlockLength == 0 {
+		return nil, fmt.Errorf("signature: invalid block size = %d", header.BlockLength)
+	}
+	return &header, nil
+}
+
+func readCDCSignatureHeader(in io.Reader) (*cdcSignatureHeader, error) {
+	header := cdcSignatureHeader{}
+	if err := readHeader(in, &header); err != nil {
+		return nil, err
+	}
+	if err := checkMagicAndVersion(header.Magic, cdcSignatureMagic, header.Version, cdcSignatureFormatVersion); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	if !StrongHash(header.StrongHash).valid() {
+		return nil, fmt.Errorf("signature: unknown strong hash algorithm = %d", header.StrongHash)
+	}
+	maxStrongLength := StrongHash(header.StrongHash).Size()
+	if uint32(header.StrongLength) != maxStrongLength {
+		return nil, fmt.Errorf("signature: invalid strong hash length = %d, want = %d", header.StrongLength, maxStrongLength)
+	}
+	params := cdc.Params{MinSize: int(header.MinSize), AvgSize: int(header.AvgSize), MaxSize: int(header.MaxSize)}
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	return &header, nil
+}
+
+func newDeltaHeader(compression Compression, checksum StrongHash, selfWindow uint32, encoding Encoding) *deltaHeader {
+	version := deltaFormatVersion
+	switch {
+	case encoding == EncodingFixed && selfWindow == 0:
+		version = 3
+	case encoding == EncodingFixed:
+		version = 4
+	}
+	return &deltaHeader{
+		Magic:        deltaMagic,
+		Version:      version,
+		Compression:  uint8(compression),
+		ChecksumHash: uint8(checksum),
+		SelfWindow:   selfWindow,
+	}
+}
+
+func readDeltaHeader(in io.Reader) (*deltaHeader, error) {
+	prefix := headerPrefix{}
+	if err := readHeader(in, &prefix); err != nil {
+		return nil, err
+	}
+	if err := checkMagicAndVersion(prefix.Magic, deltaMagic, prefix.Version, deltaFormatVersion); err != nil {
+		return nil, fmt.Errorf("delta: %w", err)
+	}
+	header := deltaHeader{
+		Magic:   prefix.Magic,
+		Version: prefix.Version,
+	}
+	if header.Version >= 2 {
+		if err := readHeader(in, &header.Compression); err != nil {
+			return nil, err
+		}
+		if !Compression(header.Compression).valid() {
+			return nil, fmt.Errorf("delta: unknown compression = %d", header.Compression)
+		}
+	}
+	if header.hasEndRecord() {
+		if err := readHeader(in, &header.ChecksumHash); err != nil {
+			return nil, err
+		}
+		if !StrongHash(header.ChecksumHash).valid() {
+			return nil, fmt.Errorf("delta: unknown checksum algorithm = %d", header.ChecksumHash)
+		}
+	}
+	if header.hasSelfWindow() {
+		if err := readHeader(in, &header.SelfWindow); err != nil {
+			return nil, err
+		}
+		if header.SelfWindow == 0 && header.encoding() == EncodingFixed {
+			return nil, fmt.Errorf("delta: invalid self copy window = %d", header.SelfWindow)
+		}
+	}
+	return &header, nil
+}
+
+func (h *deltaHeader) hasEndRecord() bool {
+	return h.Version >= 3
+}
+
+func (h *deltaHeader) hasSelfWindow() bool {
+	return h.Version >= 4
+}
+
+func (h *deltaHeader) encoding() Encoding {
+	if h.Version >= 5 {
+		return EncodingCompact
+	}
+	return EncodingFixed
+}
+
+func (h *deltaHeader) write(out io.Writer) error {
+	if !h.hasSelfWindow() {
+		v3 := struct {
+			Magic        uint32
+			Version      uint8
+			Compression  uint8
+			ChecksumHash uint8
+		}{h.Magic, h.Version, h.Compression, h.ChecksumHash}
+		return binary.Write(out, binary.BigEndian, v3)
+	}
+	return binary.Write(out, binary.BigEndian, h)
+}
+
+func readHeader(in io.Reader, header interface{}) error {
+	if err := binary.Read(in, binary.BigEndian, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncatedHeader
+		}
+		return err
+	}
+	return nil
+}
+
+func checkMagicAndVersion(gotMagic, wantMagic uint32, version, maxVersion uint8) error {
+	if gotMagic != wantMagic {
+		return fmt.Errorf("%w, got = %#x, want = %#x", ErrInvalidMagic, gotMagic, wantMagic)
+	}
+	if version == 0 || version > maxVersion {
+		return fmt.Errorf("%w, got = %d, max supported = %d", ErrUnsupportedVersion, version, maxVersion)
+	}
+	return nil
+}
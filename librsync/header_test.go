@@ -0,0 +1,101 @@
+package librsync
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSignatureHeaderErrors(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveInput []byte
+		wantErr   error
+	}{
+		{
+			desc:      "should reject empty input",
+			giveInput: []byte{},
+			wantErr:   ErrTruncatedHeader,
+		},
+		{
+			desc:      "should reject truncated header",
+			giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0},
+			wantErr:   ErrTruncatedHeader,
+		},
+		{
+			desc:      "should reject delta file",
+			giveInput: []byte{0x72, 0x64, 0x64, 0x6c, 1, 0, 32, 0, 0, 0, 0, 32},
+			wantErr:   ErrInvalidMagic,
+		},
+		{
+			desc:      "should reject future version",
+			giveInput: []byte{0x72, 0x64, 0x73, 0x67, 2, 0, 32, 0, 0, 0, 0, 32},
+			wantErr:   ErrUnsupportedVersion,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadSignature(bytes.NewBuffer(tc.giveInput))
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestReadSignatureInvalidHeader(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveInput []byte
+	}{
+		{desc: "should reject unknown strong hash", giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 99, 32, 0, 0, 0, 0, 32}},
+		{desc: "should reject too long strong hash", giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0, 33, 0, 0, 0, 0, 32}},
+		{desc: "should reject unknown weak hash", giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 99, 0, 0, 0, 32}},
+		{desc: "should reject zero block size", giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 0, 0, 0, 0, 0}},
+		{desc: "should reject truncated block", giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 0, 0, 0, 0, 32, 1, 2}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadSignature(bytes.NewBuffer(tc.giveInput))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReadDeltaHeaderErrors(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveInput []byte
+		wantErr   error
+	}{
+		{
+			desc:      "should reject empty input",
+			giveInput: []byte{},
+			wantErr:   ErrTruncatedHeader,
+		},
+		{
+			desc:      "should reject signature file",
+			giveInput: []byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 0, 0, 0, 0, 32},
+			wantErr:   ErrInvalidMagic,
+		},
+		{
+			desc:      "should reject future version",
+			giveInput: []byte{0x72, 0x64, 0x64, 0x6c, 6, 0, 0},
+			wantErr:   ErrUnsupportedVersion,
+		},
+		{
+			desc:      "should reject truncated chunk",
+			giveInput: []byte{0x72, 0x64, 0x64, 0x6c, 1, 0, 0, 0},
+			wantErr:   io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadDelta(bytes.NewBuffer(tc.giveInput))
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package librsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var ErrBlockSizeMismatch = errors.New("block sizes differ")
+
+type ChunkKind uint8
+
+const (
+	ChunkCopy ChunkKind = iota
+	ChunkLiteral
+	ChunkSelfCopy
+)
+
+var chunkKindNames = map[ChunkKind]string{
+	ChunkCopy:     "copy",
+	ChunkLiteral:  "literal",
+	ChunkSelfCopy: "self-copy",
+}
+
+func (k ChunkKind) String() string {
+	if name, ok := chunkKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ChunkKind(%d)", uint8(k))
+}
+
+type ChunkInfo struct {
+	Kind         ChunkKind
+	BaseOffset   uint64
+	Length       uint64
+	OutputOffset uint64
+}
+
+type DeltaSummary struct {
+	Chunks          int
+	CopiedBytes     uint64
+	LiteralBytes    uint64
+	SelfCopiedBytes uint64
+}
+
+func (s DeltaSummary) OutputSize() uint64 {
+	return s.CopiedBytes + s.LiteralBytes + s.SelfCopiedBytes
+}
+
+func (d *Delta) Compression() Compression {
+	return d.compression
+}
+
+func (d *Delta) Encoding() Encoding {
+	return d.encoding
+}
+
+func (d *Delta) SelfCopyWindow() uint32 {
+	return d.selfWindow
+}
+
+func (d *Delta) Chunks() []ChunkInfo {
+	infos := make([]ChunkInfo, 0, len(d.chunks))
+	position := uint64(0)
+	for _, c := range d.chunks {
+		info := ChunkInfo{OutputOffset: position}
+		switch c := c.(type) {
+		case *reusable:
+			info.Kind = ChunkCopy
+			info.BaseOffset = c.startPosition
+			info.Length = c.length
+		case *modified:
+			info.Kind = ChunkLiteral
+			info.Length = uint64(len(c.data))
+		case *selfCopy:
+			info.Kind = ChunkSelfCopy
+			info.BaseOffset = c.startPosition
+			info.Length = c.length
+		}
+		infos = append(infos, info)
+		position += info.Length
+	}
+	return infos
+}
+
+func (d *Delta) Summary() DeltaSummary {
+	summary := DeltaSummary{}
+	for _, info := range d.Chunks() {
+		summary.Chunks++
+		switch info.Kind {
+		case ChunkCopy:
+			summary.CopiedBytes += info.Length
+		case ChunkLiteral:
+			summary.LiteralBytes += info.Length
+		case ChunkSelfCopy:
+			summary.SelfCopiedBytes += info.Length
+		}
+	}
+	return summary
+}
+
+type BlockInfo struct {
+	Offset    uint64
+	WeakSum   uint32
+	StrongSum []byte
+}
+
+type BlockChange uint8
+
+const (
+	BlockChanged BlockChange = iota
+	BlockAdded
+	BlockRemoved
+)
+
+var blockChangeNames = map[BlockChange]string{
+	BlockChanged: "changed",
+	BlockAdded:   "added",
+	BlockRemoved: "removed",
+}
+
+func (c BlockChange) String() string {
+	if name, ok := blockChangeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("BlockChange(%d)", uint8(c))
+}
+
+type BlockDiff struct {
+	Index  uint64
+	Offset uint64
+	Change BlockChange
+}
+
+func (s *Signature) BlockLength() uint32 {
+	return s.blockLength
+}
+
+func (s *Signature) StrongHash() StrongHash {
+	return s.strongHash
+}
+
+func (s *Signature) StrongLength() uint32 {
+	return s.strongLength
+}
+
+func (s *Signature) RollingHash() RollingHash {
+	return s.weakHash
+}
+
+func (s *Signature) BlockCount() int {
+	return len(s.weakSignatures)
+}
+
+func (s *Signature) Blocks() []BlockInfo {
+	infos := make([]BlockInfo, 0, len(s.weakSignatures))
+	for i, weakSig := range s.weakSignatures {
+		infos = append(infos, BlockInfo{
+			Offset:    uint64(i) * uint64(s.blockLength),
+			WeakSum:   weakSig,
+			StrongSum: s.strongSignatures[i],
+		})
+	}
+	return infos
+}
+
+func DiffSignatures(a, b *Signature) ([]BlockDiff, error) {
+	if a.blockLength != b.blockLength {
+		return nil, fmt.Errorf("%w, got = %d and %d", ErrBlockSizeMismatch, a.blockLength, b.blockLength)
+	}
+	if a.strongHash != b.strongHash || a.strongLength != b.strongLength || a.weakHash != b.weakHash {
+		return nil, fmt.Errorf("hash algorithms differ, got = %s/%d/%s and %s/%d/%s",
+			a.strongHash, a.strongLength, a.weakHash, b.strongHash, b.strongLength, b.weakHash)
+	}
+	diffs := []BlockDiff{}
+	for i := 0; i < len(a.weakSignatures) || i < len(b.weakSignatures); i++ {
+		diff := BlockDiff{Index: uint64(i), Offset: uint64(i) * uint64(a.blockLength)}
+		switch {
+		case i >= len(b.weakSignatures):
+			diff.Change = BlockRemoved
+		case i >= len(a.weakSignatures):
+			diff.Change = BlockAdded
+		case a.weakSignatures[i] != b.weakSignatures[i] || !bytes.Equal(a.strongSignatures[i], b.strongSignatures[i]):
+			diff.Change = BlockChanged
+		default:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
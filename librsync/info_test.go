@@ -0,0 +1,123 @@
+package librsync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaChunks(t *testing.T) {
+	giveDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 100, length: 10},
+			&modified{data: []byte("abcdef")},
+			&reusable{startPosition: 0, length: 20},
+		},
+	}
+	wantChunks := []ChunkInfo{
+		{Kind: ChunkCopy, BaseOffset: 100, Length: 10, OutputOffset: 0},
+		{Kind: ChunkLiteral, Length: 6, OutputOffset: 10},
+		{Kind: ChunkCopy, BaseOffset: 0, Length: 20, OutputOffset: 16},
+	}
+	wantSummary := DeltaSummary{Chunks: 3, CopiedBytes: 30, LiteralBytes: 6}
+
+	assert.Equal(t, wantChunks, giveDelta.Chunks())
+	assert.Equal(t, wantSummary, giveDelta.Summary())
+	assert.Equal(t, uint64(36), giveDelta.Summary().OutputSize())
+}
+
+func TestDeltaChunksEmpty(t *testing.T) {
+	giveDelta := &Delta{}
+
+	assert.Equal(t, []ChunkInfo{}, giveDelta.Chunks())
+	assert.Equal(t, DeltaSummary{}, giveDelta.Summary())
+}
+
+func TestChunkKindString(t *testing.T) {
+	assert.Equal(t, "copy", ChunkCopy.String())
+	assert.Equal(t, "literal", ChunkLiteral.String())
+	assert.Equal(t, "self-copy", ChunkSelfCopy.String())
+	assert.Equal(t, "ChunkKind(7)", ChunkKind(7).String())
+}
+
+func TestSignatureBlocks(t *testing.T) {
+	giveData := []byte("hello world, hello there")
+	sig, err := NewSignature(bytes.NewReader(giveData), 10, WithStrongHash(MD5), WithStrongLength(8))
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint32(10), sig.BlockLength())
+	assert.Equal(t, MD5, sig.StrongHash())
+	assert.Equal(t, uint32(8), sig.StrongLength())
+	assert.Equal(t, Rollsum, sig.RollingHash())
+	assert.Equal(t, 3, sig.BlockCount())
+	blocks := sig.Blocks()
+	assert.Len(t, blocks, 3)
+	for i, block := range blocks {
+		end := (i + 1) * 10
+		if end > len(giveData) {
+			end = len(giveData)
+		}
+		assert.Equal(t, uint64(i*10), block.Offset)
+		assert.Equal(t, sig.computeRollingChecksum(giveData[i*10:end]), block.WeakSum)
+		assert.Equal(t, sig.computeStrongChecksum(giveData[i*10:end]), block.StrongSum)
+	}
+}
+
+func TestDiffSignatures(t *testing.T) {
+	giveBase := bytes.Repeat([]byte("0123456789"), 5)
+	tests := []struct {
+		desc      string
+		giveA     []byte
+		giveB     []byte
+		wantDiffs []BlockDiff
+	}{
+		{desc: "should report no changes", giveA: giveBase, giveB: giveBase, wantDiffs: []BlockDiff{}},
+		{
+			desc:      "should report changed blocks",
+			giveA:     giveBase,
+			giveB:     concat(giveBase[:12], []byte("xx"), giveBase[14:45], []byte("y"), giveBase[46:]),
+			wantDiffs: []BlockDiff{{Index: 1, Offset: 10, Change: BlockChanged}, {Index: 4, Offset: 40, Change: BlockChanged}},
+		},
+		{
+			desc:      "should report added blocks",
+			giveA:     giveBase[:25],
+			giveB:     giveBase,
+			wantDiffs: []BlockDiff{{Index: 2, Offset: 20, Change: BlockChanged}, {Index: 3, Offset: 30, Change: BlockAdded}, {Index: 4, Offset: 40, Change: BlockAdded}},
+		},
+		{
+			desc:      "should report removed blocks",
+			giveA:     giveBase,
+			giveB:     giveBase[:30],
+			wantDiffs: []BlockDiff{{Index: 3, Offset: 30, Change: BlockRemoved}, {Index: 4, Offset: 40, Change: BlockRemoved}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sigA, err := NewSignature(bytes.NewReader(tc.giveA), 10)
+			assert.NoError(t, err)
+			sigB, err := NewSignature(bytes.NewReader(tc.giveB), 10)
+			assert.NoError(t, err)
+
+			gotDiffs, err := DiffSignatures(sigA, sigB)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDiffs, gotDiffs)
+		})
+	}
+}
+
+func TestDiffSignaturesErrors(t *testing.T) {
+	giveData := []byte("some data to sign")
+	sig, err := NewSignature(bytes.NewReader(giveData), 4)
+	assert.NoError(t, err)
+	otherBlockLen, err := NewSignature(bytes.NewReader(giveData), 8)
+	assert.NoError(t, err)
+	otherHash, err := NewSignature(bytes.NewReader(giveData), 4, WithStrongHash(MD5))
+	assert.NoError(t, err)
+
+	_, err = DiffSignatures(sig, otherBlockLen)
+	assert.ErrorIs(t, err, ErrBlockSizeMismatch)
+	_, err = DiffSignatures(sig, otherHash)
+	assert.Error(t, err)
+}
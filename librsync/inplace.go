@@ -0,0 +1,171 @@
+package librsync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const inPlaceBufferSize = 1 << 16
+
+type inPlaceCopy struct {
+	source uint64
+	target uint64
+	length uint64
+}
+
+type inPlaceLiteral struct {
+	target uint64
+	data   []byte
+}
+
+func (d *Delta) PatchInPlace(f *os.File) error {
+	return d.patchInPlace(context.Background(), f)
+}
+
+func (d *Delta) patchInPlace(ctx context.Context, f *os.File) error {
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	resolved, err := d.withoutSelfCopies()
+	if err != nil {
+		return err
+	}
+	copies, literals, length := resolved.inPlaceOps()
+	for _, c := range copies {
+		if c.source+c.length > uint64(info.Size()) {
+			return fmt.Errorf("basis too short - delta copies %d bytes at offset %d, basis size = %d: %w", c.length, c.source, info.Size(), io.ErrUnexpectedEOF)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	buffered, err := applyCopies(f, copies)
+	if err != nil {
+		return err
+	}
+	for _, l := range append(literals, buffered...) {
+		if _, err := f.WriteAt(l.data, int64(l.target)); err != nil {
+			return err
+		}
+	}
+	if err := f.Truncate(int64(length)); err != nil {
+		return err
+	}
+	if d.checksum == nil {
+		return nil
+	}
+	checksum := newChecksumWriter(d.checksum.strongHash)
+	if _, err := io.Copy(checksum, io.NewSectionReader(f, 0, int64(length))); err != nil {
+		return err
+	}
+	return d.checksum.verify(checksum.checksum())
+}
+
+func (d *Delta) inPlaceOps() ([]inPlaceCopy, []inPlaceLiteral, uint64) {
+	copies := []inPlaceCopy{}
+	literals := []inPlaceLiteral{}
+	position := uint64(0)
+	for _, c := range d.chunks {
+		switch c := c.(type) {
+		case *reusable:
+			if c.length > 0 && c.startPosition != position {
+				copies = append(copies, inPlaceCopy{source: c.startPosition, target: position, length: c.length})
+			}
+			position += c.length
+		case *modified:
+			literals = append(literals, inPlaceLiteral{target: position, data: c.data})
+			position += uint64(len(c.data))
+		}
+	}
+	return copies, literals, position
+}
+
+func applyCopies(f *os.File, copies []inPlaceCopy) ([]inPlaceLiteral, error) {
+	readers := make([][]int, len(copies))
+	inDegree := make([]int, len(copies))
+	for j, c := range copies {
+		i := sort.Search(len(copies), func(i int) bool { return copies[i].target+copies[i].length > c.source })
+		for ; i < len(copies) && copies[i].target < c.source+c.length; i++ {
+			if i != j {
+				readers[j] = append(readers[j], i)
+				inDegree[i]++
+			}
+		}
+	}
+
+	ready := []int{}
+	for i := range copies {
+		if inDegree[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	done := make([]bool, len(copies))
+	remaining := len(copies)
+	buffered := []inPlaceLiteral{}
+	buffer := make([]byte, inPlaceBufferSize)
+	for remaining > 0 {
+		var j int
+		if len(ready) > 0 {
+			j, ready = ready[len(ready)-1], ready[:len(ready)-1]
+			if err := copyWithin(f, copies[j], buffer); err != nil {
+				return nil, err
+			}
+		} else {
+			j = smallestPending(copies, done)
+			data := make([]byte, copies[j].length)
+			if _, err := f.ReadAt(data, int64(copies[j].source)); err != nil {
+				return nil, err
+			}
+			buffered = append(buffered, inPlaceLiteral{target: copies[j].target, data: data})
+		}
+		done[j] = true
+		remaining--
+		for _, i := range readers[j] {
+			inDegree[i]--
+			if inDegree[i] == 0 && !done[i] {
+				ready = append(ready, i)
+			}
+		}
+	}
+	return buffered, nil
+}
+
+func smallestPending(copies []inPlaceCopy, done []bool) int {
+	best := -1
+	for i, c := range copies {
+		if !done[i] && (best < 0 || c.length < copies[best].length) {
+			best = i
+		}
+	}
+	return best
+}
+
+func copyWithin(f *os.File, c inPlaceCopy, buffer []byte) error {
+	backward := c.target > c.source
+	for done := uint64(0); done < c.length; {
+		n := c.length - done
+		if n > uint64(len(buffer)) {
+			n = uint64(len(buffer))
+		}
+		offset := done
+		if backward {
+			offset = c.length - done - n
+		}
+		if _, err := f.ReadAt(buffer[:n], int64(c.source+offset)); err != nil {
+			return err
+		}
+		if _, err := f.WriteAt(buffer[:n], int64(c.target+offset)); err != nil {
+			return err
+		}
+		done += n
+	}
+	return nil
+}
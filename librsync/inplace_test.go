@@ -0,0 +1,104 @@
+package librsync
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTempFile(t *testing.T, data []byte) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), "basis"))
+	assert.NoError(t, err)
+	_, err = f.Write(data)
+	assert.NoError(t, err)
+	return f
+}
+
+func TestDeltaPatchInPlace(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 100000)
+	rnd.Read(giveOld)
+	tests := []struct {
+		desc    string
+		giveNew []byte
+	}{
+		{desc: "should handle no changes", giveNew: giveOld},
+		{desc: "should handle modification", giveNew: concat(giveOld[:3000], []byte("modified"), giveOld[3008:])},
+		{desc: "should handle insertion at start", giveNew: concat([]byte("inserted"), giveOld)},
+		{desc: "should handle deletion at start", giveNew: giveOld[5000:]},
+		{desc: "should handle swapped halves", giveNew: concat(giveOld[50000:], giveOld[:50000])},
+		{desc: "should handle rotated thirds", giveNew: concat(giveOld[60000:], giveOld[30000:60000], giveOld[:30000])},
+		{desc: "should handle repeated blocks", giveNew: concat(giveOld[:20000], giveOld[:20000], giveOld[:20000])},
+		{desc: "should handle growth", giveNew: concat(giveOld, giveOld, []byte("tail"))},
+		{desc: "should handle truncation", giveNew: giveOld[:1234]},
+		{desc: "should handle empty new file", giveNew: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(giveOld), 256)
+			assert.NoError(t, err)
+			delta, err := NewDelta(bytes.NewReader(tc.giveNew), sig)
+			assert.NoError(t, err)
+
+			f := writeTempFile(t, giveOld)
+			defer f.Close()
+			assert.NoError(t, delta.PatchInPlace(f))
+			got, err := ioutil.ReadFile(f.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, string(tc.giveNew), string(got))
+		})
+	}
+}
+
+func TestDeltaPatchInPlaceCycle(t *testing.T) {
+	giveDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 4, length: 4},
+			&reusable{startPosition: 0, length: 4},
+			&reusable{startPosition: 10, length: 2},
+			&reusable{startPosition: 8, length: 2},
+		},
+	}
+	f := writeTempFile(t, []byte("abcdefghij12"))
+	defer f.Close()
+
+	assert.NoError(t, giveDelta.PatchInPlace(f))
+	got, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "efghabcd12ij", string(got))
+}
+
+func TestDeltaPatchInPlaceErrors(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveDelta *Delta
+		wantErr   error
+	}{
+		{
+			desc:      "should reject too short basis",
+			giveDelta: &Delta{chunks: []chunk{&reusable{startPosition: 4, length: 20}}},
+			wantErr:   io.ErrUnexpectedEOF,
+		},
+		{
+			desc:      "should report checksum mismatch",
+			giveDelta: &Delta{chunks: []chunk{&reusable{startPosition: 0, length: 8}}, checksum: checksumOf([]byte("expected"))},
+			wantErr:   ErrChecksumMismatch,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			f := writeTempFile(t, []byte("basis data"))
+			defer f.Close()
+
+			assert.ErrorIs(t, tc.giveDelta.PatchInPlace(f), tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package librsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+const checksumHash = SHA256
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	errMissingEndRecord = fmt.Errorf("corrupted delta - missing end record: %w", io.ErrUnexpectedEOF)
+)
+
+type fileChecksum struct {
+	strongHash StrongHash
+	length     uint64
+	sum        []byte
+}
+
+type checksumWriter struct {
+	strongHash StrongHash
+	hash       hash.Hash
+	length     uint64
+}
+
+func newChecksumWriter(strongHash StrongHash) *checksumWriter {
+	return &checksumWriter{
+		strongHash: strongHash,
+		hash:       strongHash.new(),
+	}
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.length += uint64(len(p))
+	return w.hash.Write(p)
+}
+
+func (w *checksumWriter) checksum() *fileChecksum {
+	return &fileChecksum{
+		strongHash: w.strongHash,
+		length:     w.length,
+		sum:        w.hash.Sum(nil),
+	}
+}
+
+func (c *fileChecksum) verify(got *fileChecksum) error {
+	if got.length != c.length {
+		return fmt.Errorf("%w: length got = %d, want = %d", ErrChecksumMismatch, got.length, c.length)
+	}
+	if !bytes.Equal(got.sum, c.sum) {
+		return fmt.Errorf("%w: %s got = %x, want = %x", ErrChecksumMismatch, c.strongHash, got.sum, c.sum)
+	}
+	return nil
+}
+
+func writeEndRecord(out io.Writer, c *fileChecksum) error {
+	record := struct {
+		Type      chunkType
+		SumLength uint8
+		Length    uint64
+	}{Type: chunkTypeEnd}
+	if c != nil {
+		record.SumLength = uint8(len(c.sum))
+		record.Length = c.length
+	}
+	if err := binary.Write(out, binary.BigEndian, record); err != nil {
+		return err
+	}
+	if c == nil {
+		return nil
+	}
+	_, err := out.Write(c.sum)
+	return err
+}
+
+func readEndRecord(in io.Reader, strongHash StrongHash) (*fileChecksum, error) {
+	var record struct {
+		SumLength uint8
+		Length    uint64
+	}
+	if err := binary.Read(in, binary.BigEndian, &record); err != nil {
+		return nil, truncatedChunkError(err)
+	}
+	if record.SumLength == 0 {
+		return nil, nil
+	}
+	if uint32(record.SumLength) != strongHash.Size() {
+		return nil, fmt.Errorf("corrupted end record - invalid %s checksum length = %d", strongHash, record.SumLength)
+	}
+	sum := make([]byte, record.SumLength)
+	if _, err := io.ReadFull(in, sum); err != nil {
+		return nil, truncatedChunkError(err)
+	}
+	return &fileChecksum{
+		strongHash: strongHash,
+		length:     record.Length,
+		sum:        sum,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package librsync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchChecksumMismatch(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	giveWrongBase := []byte("the quick brown cat jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	giveInput := []byte("the quick brown fox jumps over the lazy dog; a new line; pack my box with five dozen liquor jugs")
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(giveInput), sig, deltaBuff))
+
+	err = ApplyPatch(bytes.NewReader(giveWrongBase), bytes.NewReader(deltaBuff.Bytes()), &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	delta, err := ReadDelta(bytes.NewReader(deltaBuff.Bytes()))
+	assert.NoError(t, err)
+	err = delta.Patch(bytes.NewReader(giveWrongBase), &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	err = delta.Patch(bytes.NewReader(giveBase[:40]), &bytes.Buffer{})
+	assert.Error(t, err)
+
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, delta.Patch(bytes.NewReader(giveBase), gotBuff))
+	assert.Equal(t, giveInput, gotBuff.Bytes())
+}
+
+func TestPatchMissingEndRecord(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog")
+	giveInput := []byte("the quick brown fox jumps over the lazy dog!")
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(giveInput), sig, deltaBuff))
+	truncated := deltaBuff.Bytes()[:deltaBuff.Len()-42]
+
+	_, err = ReadDelta(bytes.NewReader(truncated))
+	assert.ErrorIs(t, err, errMissingEndRecord)
+	err = ApplyPatch(bytes.NewReader(giveBase), bytes.NewReader(truncated), &bytes.Buffer{})
+	assert.ErrorIs(t, err, errMissingEndRecord)
+}
+
+func TestPatchWithoutChecksum(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog")
+	giveDelta := &Delta{
+		chunks: []chunk{
+			&reusable{startPosition: 0, length: 10},
+			&modified{data: []byte("red")},
+		},
+	}
+
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, giveDelta.Write(deltaBuff))
+	gotBuff := &bytes.Buffer{}
+	assert.NoError(t, ApplyPatch(bytes.NewReader(giveBase), deltaBuff, gotBuff))
+	assert.Equal(t, []byte("the quick red"), gotBuff.Bytes())
+}
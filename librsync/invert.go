@@ -0,0 +1,104 @@
+package librsync
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+type rangeMapping struct {
+	basePosition   uint64
+	outputPosition uint64
+	length         uint64
+}
+
+func (d *Delta) Invert(base io.ReadSeeker) (*Delta, error) {
+	baseSize, err := base.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := base.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	resolved, err := d.withoutSelfCopies()
+	if err != nil {
+		return nil, err
+	}
+	mappings := resolved.reusableMappings()
+	for _, m := range mappings {
+		if m.basePosition+m.length > uint64(baseSize) {
+			return nil, fmt.Errorf("basis too short - delta copies %d bytes at offset %d, basis size = %d: %w", m.length, m.basePosition, baseSize, io.ErrUnexpectedEOF)
+		}
+	}
+	sort.SliceStable(mappings, func(i, j int) bool {
+		return mappings[i].basePosition < mappings[j].basePosition
+	})
+
+	strongHash := checksumHash
+	if d.checksum != nil {
+		strongHash = d.checksum.strongHash
+	}
+	checksum := newChecksumWriter(strongHash)
+	inverted := Delta{compression: d.compression, encoding: d.encoding}
+	position := uint64(0)
+	for _, m := range mappings {
+		end := m.basePosition + m.length
+		if end <= position {
+			continue
+		}
+		start := m.basePosition
+		if start < position {
+			start = position
+		}
+		if err := inverted.addBaseLiteral(base, checksum, start-position); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(checksum, base, int64(end-start)); err != nil {
+			return nil, err
+		}
+		inverted.addChunk(&reusable{
+			startPosition: m.outputPosition + start - m.basePosition,
+			length:        end - start,
+		})
+		position = end
+	}
+	if err := inverted.addBaseLiteral(base, checksum, uint64(baseSize)-position); err != nil {
+		return nil, err
+	}
+	inverted.checksum = checksum.checksum()
+	return &inverted, nil
+}
+
+func (d *Delta) reusableMappings() []rangeMapping {
+	mappings := []rangeMapping{}
+	position := uint64(0)
+	for _, c := range d.chunks {
+		switch c := c.(type) {
+		case *reusable:
+			mappings = append(mappings, rangeMapping{
+				basePosition:   c.startPosition,
+				outputPosition: position,
+				length:         c.length,
+			})
+			position += c.length
+		case *modified:
+			position += uint64(len(c.data))
+		}
+	}
+	return mappings
+}
+
+func (d *Delta) addBaseLiteral(base io.Reader, checksum io.Writer, length uint64) error {
+	if length == 0 {
+		return nil
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(base, data); err != nil {
+		return err
+	}
+	if _, err := checksum.Write(data); err != nil {
+		return err
+	}
+	d.addChunk(&modified{data: data})
+	return nil
+}
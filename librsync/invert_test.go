@@ -0,0 +1,79 @@
+package librsync
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaInvert(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 10000)
+	rnd.Read(giveOld)
+	tests := []struct {
+		desc    string
+		giveNew []byte
+	}{
+		{desc: "should handle no changes", giveNew: giveOld},
+		{desc: "should handle modification", giveNew: concat(giveOld[:3000], []byte("modified"), giveOld[3008:])},
+		{desc: "should handle insertion", giveNew: concat(giveOld[:5000], []byte("inserted"), giveOld[5000:])},
+		{desc: "should handle deletion", giveNew: concat(giveOld[:2000], giveOld[4000:])},
+		{desc: "should handle moved and repeated blocks", giveNew: concat(giveOld[6400:], giveOld[:3200], giveOld[:3200])},
+		{desc: "should handle truncation", giveNew: giveOld[:1000]},
+		{desc: "should handle empty new file", giveNew: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(giveOld), 64)
+			assert.NoError(t, err)
+			delta, err := NewDelta(bytes.NewReader(tc.giveNew), sig)
+			assert.NoError(t, err)
+
+			inverted, err := delta.Invert(bytes.NewReader(giveOld))
+			assert.NoError(t, err)
+			out := &bytes.Buffer{}
+			assert.NoError(t, inverted.Patch(bytes.NewReader(tc.giveNew), out))
+			assert.Equal(t, giveOld, out.Bytes())
+
+			deltaBuff := &bytes.Buffer{}
+			assert.NoError(t, inverted.Write(deltaBuff))
+			out.Reset()
+			assert.NoError(t, ApplyPatch(bytes.NewReader(tc.giveNew), deltaBuff, out))
+			assert.Equal(t, giveOld, out.Bytes())
+		})
+	}
+}
+
+func TestDeltaInvertChunks(t *testing.T) {
+	giveDelta := &Delta{
+		chunks: []chunk{
+			&modified{data: []byte("new")},
+			&reusable{startPosition: 4, length: 4},
+			&reusable{startPosition: 2, length: 4},
+		},
+	}
+	wantDelta := &Delta{
+		chunks: []chunk{
+			&modified{data: []byte("ba")},
+			&reusable{startPosition: 7, length: 4},
+			&reusable{startPosition: 5, length: 2},
+			&modified{data: []byte("hij")},
+		},
+		checksum: checksumOf([]byte("basedefghij")),
+	}
+
+	gotDelta, err := giveDelta.Invert(bytes.NewReader([]byte("basedefghij")))
+	assert.NoError(t, err)
+	assert.Equal(t, wantDelta, gotDelta)
+}
+
+func TestDeltaInvertBasisTooShort(t *testing.T) {
+	giveDelta := &Delta{chunks: []chunk{&reusable{startPosition: 8, length: 16}}}
+
+	_, err := giveDelta.Invert(bytes.NewReader(make([]byte, 20)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package librsync
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaPatchInPlaceLocked(t *testing.T) {
+	f := writeTempFile(t, []byte("basis data"))
+	defer f.Close()
+	other, err := os.Open(f.Name())
+	assert.NoError(t, err)
+	defer other.Close()
+	assert.NoError(t, lockFile(other))
+	defer unlockFile(other)
+
+	giveDelta := &Delta{chunks: []chunk{&modified{data: []byte("new")}}}
+	assert.Error(t, giveDelta.PatchInPlace(f))
+}
@@ -0,0 +1,103 @@
+package librsync
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const parallelBatchBlocks = 64
+
+func NewSignatureParallel(r io.ReaderAt, size int64, blockLen uint32, workers int, opts ...SignatureOption) (*Signature, error) {
+	sig, options, err := newSignature(blockLen, SHA256, Rollsum, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := sig.computeParallel(r, size, workers, newProgressTracker(options.progress)); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *Signature) computeParallel(r io.ReaderAt, size int64, workers int, progress *progressTracker) error {
+	if size < 0 {
+		return fmt.Errorf("invalid input size = %d", size)
+	}
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	blockLen := int64(s.blockLength)
+	blockCount := int((size + blockLen - 1) / blockLen)
+	weakSigs := make([]uint32, blockCount)
+	strongSigs := make([][]byte, blockCount)
+
+	batches := make(chan int)
+	errs := make(chan error, workers)
+	wg := sync.WaitGroup{}
+	progressLock := sync.Mutex{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buffer := make([]byte, blockLen)
+			for first := range batches {
+				for id := first; id < first+parallelBatchBlocks && id < blockCount; id++ {
+					offset := int64(id) * blockLen
+					block := buffer
+					if offset+blockLen > size {
+						block = buffer[:size-offset]
+					}
+					n, err := r.ReadAt(block, offset)
+					if n < len(block) {
+						if err == nil || err == io.EOF {
+							err = io.ErrUnexpectedEOF
+						}
+						errs <- err
+						return
+					}
+					weakSigs[id] = s.computeRollingChecksum(block)
+					strongSigs[id] = s.computeStrongChecksum(block)
+				}
+				progressLock.Lock()
+				progress.scanned(int(minInt64(size-int64(first)*blockLen, parallelBatchBlocks*blockLen)))
+				progressLock.Unlock()
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for first := 0; first < blockCount; first += parallelBatchBlocks {
+		select {
+		case batches <- first:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(batches)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.weakSignaturesToBlockIDs = make(map[uint32][]uint64)
+	for id := range weakSigs {
+		s.addBlock(weakSigs[id], strongSigs[id])
+	}
+	progress.done()
+	return nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package librsync
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSignatureParallel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		desc         string
+		giveSize     int
+		giveBlockLen uint32
+		giveWorkers  int
+	}{
+		{desc: "should handle empty input", giveSize: 0, giveBlockLen: 32, giveWorkers: 4},
+		{desc: "should handle single short block", giveSize: 10, giveBlockLen: 32, giveWorkers: 4},
+		{desc: "should handle exact blocks", giveSize: 32 * 1000, giveBlockLen: 32, giveWorkers: 3},
+		{desc: "should handle trailing short block", giveSize: 32*1000 + 7, giveBlockLen: 32, giveWorkers: 8},
+		{desc: "should handle single worker", giveSize: 100000, giveBlockLen: 100, giveWorkers: 1},
+		{desc: "should default number of workers", giveSize: 100000, giveBlockLen: 100, giveWorkers: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			giveData := make([]byte, tc.giveSize)
+			rnd.Read(giveData)
+			copy(giveData[len(giveData)/2:], giveData[:len(giveData)/4])
+
+			wantSig, err := NewSignature(bytes.NewReader(giveData), tc.giveBlockLen)
+			assert.NoError(t, err)
+			for i := 0; i < 3; i++ {
+				gotSig, err := NewSignatureParallel(bytes.NewReader(giveData), int64(len(giveData)), tc.giveBlockLen, tc.giveWorkers)
+				assert.NoError(t, err)
+				assert.Equal(t, wantSig, gotSig)
+			}
+		})
+	}
+}
+
+func TestNewSignatureParallelWithOptions(t *testing.T) {
+	giveData := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 100)
+
+	wantSig, err := NewSignature(bytes.NewReader(giveData), 16, WithStrongHash(MD5), WithStrongLength(8))
+	assert.NoError(t, err)
+	gotSig, err := NewSignatureParallel(bytes.NewReader(giveData), int64(len(giveData)), 16, 4, WithStrongHash(MD5), WithStrongLength(8))
+	assert.NoError(t, err)
+	assert.Equal(t, wantSig, gotSig)
+}
+
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestNewSignatureParallelErrors(t *testing.T) {
+	_, err := NewSignatureParallel(failingReaderAt{}, 100000, 32, 4)
+	assert.Error(t, err)
+
+	_, err = NewSignatureParallel(bytes.NewReader([]byte("short")), 100, 32, 4)
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package librsync
+
+import (
+	"bufio"
+	"io"
+)
+
+func ApplyPatch(base io.ReadSeeker, delta io.Reader, out io.Writer, opts ...PatchOption) error {
+	progress := newProgressTracker(newPatchOptions(opts).progress)
+	in := bufio.NewReader(newProgressReader(delta, progress))
+	header, err := readDeltaHeader(in)
+	if err != nil {
+		return err
+	}
+	compression := Compression(header.Compression)
+	bufOut := bufio.NewWriter(out)
+	checksum := newChecksumWriter(StrongHash(header.ChecksumHash))
+	patched := io.MultiWriter(bufOut, checksum)
+	progressOut := &progressWriter{out: patched, tracker: progress}
+	patched = progressOut
+	history := newOutputHistory(header.SelfWindow)
+	if history != nil {
+		patched = io.MultiWriter(patched, history)
+	}
+	codec := header.encoding().newCodec()
+	for {
+		chunkHeader, err := codec.readHeader(in)
+		if err != nil {
+			if err == io.EOF && !header.hasEndRecord() {
+				break
+			}
+			if err == io.EOF {
+				return errMissingEndRecord
+			}
+			return err
+		}
+		if chunkHeader.cType == chunkTypeEnd {
+			want, err := readEndRecord(in, StrongHash(header.ChecksumHash))
+			if err != nil {
+				return err
+			}
+			if want != nil {
+				if err := want.verify(checksum.checksum()); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		progressOut.matching = chunkHeader.cType != chunkTypeModified
+		if err := chunkHeader.patch(base, in, patched, history, compression); err != nil {
+			return err
+		}
+	}
+	progress.done()
+	return bufOut.Flush()
+}
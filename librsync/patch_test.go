@@ -0,0 +1,58 @@
+package librsync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPatch(t *testing.T) {
+	giveBaseBuff := bytes.NewReader([]byte{104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104,
+		101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108,
+		108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32})
+	giveDeltaBuff := bytes.NewBuffer([]byte{0x72, 0x64, 0x64, 0x6c, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 32, 1, 0, 0, 0, 0, 0, 0,
+		0, 1, 19, 0, 0, 0, 0, 0, 0, 0, 0, 32, 0, 0, 0, 0, 0, 0, 0, 34})
+	wantBuff := bytes.NewBuffer([]byte{104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104,
+		101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 19, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108,
+		108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32})
+
+	gotBuff := &bytes.Buffer{}
+	err := ApplyPatch(giveBaseBuff, giveDeltaBuff, gotBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, wantBuff, gotBuff)
+}
+
+func TestApplyPatchLargeLiteral(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog")
+	giveInput := append(bytes.Repeat([]byte("0123456789"), 100000), giveBase...)
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8)
+	assert.NoError(t, err)
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(giveInput), sig, deltaBuff))
+
+	gotBuff := &bytes.Buffer{}
+	err = ApplyPatch(bytes.NewReader(giveBase), deltaBuff, gotBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, giveInput, gotBuff.Bytes())
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveDelta []byte
+	}{
+		{desc: "should reject missing header", giveDelta: []byte{}},
+		{desc: "should reject truncated chunk", giveDelta: []byte{0x72, 0x64, 0x64, 0x6c, 1, 0, 0, 0, 0}},
+		{desc: "should reject truncated literal", giveDelta: []byte{0x72, 0x64, 0x64, 0x6c, 1, 1, 0, 0, 0, 0, 0, 0, 0, 5, 19}},
+		{desc: "should reject unknown chunk type", giveDelta: []byte{0x72, 0x64, 0x64, 0x6c, 1, 9}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := ApplyPatch(bytes.NewReader([]byte("base")), bytes.NewBuffer(tc.giveDelta), &bytes.Buffer{})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package librsync
+
+import "io"
+
+const progressInterval = 1 << 20
+
+type Progress struct {
+	BytesRead    uint64
+	BytesMatched uint64
+	LiteralBytes uint64
+	Offset       uint64
+}
+
+type ProgressFunc func(Progress)
+
+type PatchOption func(*patchOptions)
+
+type patchOptions struct {
+	progress ProgressFunc
+}
+
+func WithSignatureProgress(fn ProgressFunc) SignatureOption {
+	return func(o *signatureOptions) {
+		o.progress = fn
+	}
+}
+
+func WithDeltaProgress(fn ProgressFunc) DeltaOption {
+	return func(o *deltaOptions) {
+		o.progress = fn
+	}
+}
+
+func WithPatchProgress(fn ProgressFunc) PatchOption {
+	return func(o *patchOptions) {
+		o.progress = fn
+	}
+}
+
+func newPatchOptions(opts []PatchOption) patchOptions {
+	options := patchOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+type progressTracker struct {
+	fn       ProgressFunc
+	progress Progress
+	reported uint64
+}
+
+func newProgressTracker(fn ProgressFunc) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{fn: fn}
+}
+
+func (t *progressTracker) read(n int) {
+	if t == nil {
+		return
+	}
+	t.progress.BytesRead += uint64(n)
+	t.update()
+}
+
+func (t *progressTracker) scanned(n int) {
+	if t == nil {
+		return
+	}
+	t.progress.BytesRead += uint64(n)
+	t.progress.Offset += uint64(n)
+	t.update()
+}
+
+func (t *progressTracker) matched(n uint64) {
+	if t == nil {
+		return
+	}
+	t.progress.BytesMatched += n
+	t.progress.Offset += n
+	t.update()
+}
+
+func (t *progressTracker) literal(n uint64) {
+	if t == nil {
+		return
+	}
+	t.progress.LiteralBytes += n
+	t.progress.Offset += n
+	t.update()
+}
+
+func (t *progressTracker) update() {
+	if t.progress.Offset-t.reported >= progressInterval {
+		t.reported = t.progress.Offset
+		t.fn(t.progress)
+	}
+}
+
+func (t *progressTracker) done() {
+	if t != nil {
+		t.fn(t.progress)
+	}
+}
+
+type progressReader struct {
+	in      io.Reader
+	tracker *progressTracker
+}
+
+func newProgressReader(in io.Reader, tracker *progressTracker) io.Reader {
+	if tracker == nil {
+		return in
+	}
+	return &progressReader{in: in, tracker: tracker}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.in.Read(p)
+	r.tracker.read(n)
+	return n, err
+}
+
+type progressWriter struct {
+	out      io.Writer
+	tracker  *progressTracker
+	matching bool
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	if w.matching {
+		w.tracker.matched(uint64(n))
+	} else {
+		w.tracker.literal(uint64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,191 @@
+package librsync
+
+import (
+	"bytes"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Pirellik/simple-rdiff/cdc"
+	"github.com/stretchr/testify/assert"
+)
+
+type progressRecorder struct {
+	reports []Progress
+}
+
+func (r *progressRecorder) record(p Progress) {
+	r.reports = append(r.reports, p)
+}
+
+func (r *progressRecorder) last() Progress {
+	if len(r.reports) == 0 {
+		return Progress{}
+	}
+	return r.reports[len(r.reports)-1]
+}
+
+func (r *progressRecorder) monotonic() bool {
+	for i := 1; i < len(r.reports); i++ {
+		if r.reports[i].BytesRead < r.reports[i-1].BytesRead || r.reports[i].Offset < r.reports[i-1].Offset {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *progressRecorder) spaced() bool {
+	for i := 1; i < len(r.reports)-1; i++ {
+		if r.reports[i].Offset-r.reports[i-1].Offset < progressInterval {
+			return false
+		}
+	}
+	return true
+}
+
+type countingReaderAt struct {
+	*bytes.Reader
+	read int64
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	atomic.AddInt64(&r.read, int64(n))
+	return n, err
+}
+
+func TestSignatureProgress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveData := make([]byte, 3<<20+100)
+	rnd.Read(giveData)
+	tests := []struct {
+		desc string
+		give func(opt SignatureOption) error
+	}{
+		{
+			desc: "should report signature progress",
+			give: func(opt SignatureOption) error {
+				_, err := NewSignature(bytes.NewReader(giveData), 2048, opt)
+				return err
+			},
+		},
+		{
+			desc: "should report librsync signature progress",
+			give: func(opt SignatureOption) error {
+				_, err := NewLibrsyncSignature(bytes.NewReader(giveData), 2048, opt)
+				return err
+			},
+		},
+		{
+			desc: "should report parallel signature progress",
+			give: func(opt SignatureOption) error {
+				_, err := NewSignatureParallel(bytes.NewReader(giveData), int64(len(giveData)), 2048, 4, opt)
+				return err
+			},
+		},
+		{
+			desc: "should report content-defined signature progress",
+			give: func(opt SignatureOption) error {
+				_, err := NewCDCSignature(bytes.NewReader(giveData), cdc.DefaultParams, opt)
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			recorder := &progressRecorder{}
+			assert.NoError(t, tc.give(WithSignatureProgress(recorder.record)))
+			assert.Greater(t, len(recorder.reports), 1)
+			assert.True(t, recorder.monotonic())
+			assert.True(t, recorder.spaced())
+			assert.Equal(t, Progress{BytesRead: uint64(len(giveData)), Offset: uint64(len(giveData))}, recorder.last())
+		})
+	}
+}
+
+func TestParallelSignatureProgress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveData := make([]byte, 3<<20+100)
+	rnd.Read(giveData)
+	in := &countingReaderAt{Reader: bytes.NewReader(giveData)}
+
+	recorder := &progressRecorder{}
+	ahead := false
+	_, err := NewSignatureParallel(in, int64(len(giveData)), 2048, 4, WithSignatureProgress(func(p Progress) {
+		ahead = ahead || p.Offset > uint64(atomic.LoadInt64(&in.read))
+		recorder.record(p)
+	}))
+	assert.NoError(t, err)
+	assert.False(t, ahead)
+	assert.True(t, recorder.monotonic())
+	assert.Equal(t, uint64(len(giveData)), recorder.last().Offset)
+}
+
+func TestDeltaProgress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 3<<20)
+	rnd.Read(giveOld)
+	giveNew := concat(giveOld[:1<<20], bytes.Repeat([]byte("inserted"), 1000), giveOld[1<<20:])
+	sig, err := NewSignature(bytes.NewReader(giveOld), 2048)
+	assert.NoError(t, err)
+
+	recorder := &progressRecorder{}
+	delta, err := NewDelta(bytes.NewReader(giveNew), sig, WithDeltaProgress(recorder.record))
+	assert.NoError(t, err)
+	summary := delta.Summary()
+	wantProgress := Progress{
+		BytesRead:    uint64(len(giveNew)),
+		BytesMatched: summary.CopiedBytes,
+		LiteralBytes: summary.LiteralBytes,
+		Offset:       uint64(len(giveNew)),
+	}
+	assert.Greater(t, len(recorder.reports), 1)
+	assert.True(t, recorder.monotonic())
+	assert.True(t, recorder.spaced())
+	assert.Equal(t, wantProgress, recorder.last())
+
+	recorder = &progressRecorder{}
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(giveNew), sig, deltaBuff, WithDeltaProgress(recorder.record)))
+	assert.Equal(t, wantProgress, recorder.last())
+
+	recorder = &progressRecorder{}
+	out := &bytes.Buffer{}
+	assert.NoError(t, delta.Patch(bytes.NewReader(giveOld), out, WithPatchProgress(recorder.record)))
+	assert.Equal(t, giveNew, out.Bytes())
+	assert.True(t, recorder.monotonic())
+	assert.True(t, recorder.spaced())
+	assert.Equal(t, Progress{BytesMatched: summary.CopiedBytes, LiteralBytes: summary.LiteralBytes, Offset: uint64(len(giveNew))}, recorder.last())
+
+	recorder = &progressRecorder{}
+	wantProgress.BytesRead = uint64(deltaBuff.Len())
+	out.Reset()
+	assert.NoError(t, ApplyPatch(bytes.NewReader(giveOld), deltaBuff, out, WithPatchProgress(recorder.record)))
+	assert.Equal(t, giveNew, out.Bytes())
+	assert.True(t, recorder.monotonic())
+	assert.Equal(t, wantProgress, recorder.last())
+}
+
+func TestLibrsyncProgress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveOld := make([]byte, 100000)
+	rnd.Read(giveOld)
+	giveNew := concat(giveOld[:50000], []byte("inserted"), giveOld[50000:])
+	sig, err := NewLibrsyncSignature(bytes.NewReader(giveOld), 512)
+	assert.NoError(t, err)
+
+	recorder := &progressRecorder{}
+	deltaBuff := &bytes.Buffer{}
+	assert.NoError(t, WriteLibrsyncDelta(bytes.NewReader(giveNew), sig, deltaBuff, WithDeltaProgress(recorder.record)))
+	assert.Equal(t, uint64(len(giveNew)), recorder.last().BytesRead)
+	assert.Equal(t, uint64(len(giveNew)), recorder.last().BytesMatched+recorder.last().LiteralBytes)
+
+	deltaSize := deltaBuff.Len()
+	recorder = &progressRecorder{}
+	out := &bytes.Buffer{}
+	assert.NoError(t, ApplyLibrsyncPatch(bytes.NewReader(giveOld), deltaBuff, out, WithPatchProgress(recorder.record)))
+	assert.Equal(t, giveNew, out.Bytes())
+	assert.Equal(t, uint64(deltaSize), recorder.last().BytesRead)
+	assert.Equal(t, uint64(len(giveNew)), recorder.last().Offset)
+}
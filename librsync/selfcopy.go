@@ -0,0 +1,233 @@
+package librsync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	DefaultSelfCopyWindow = 1 << 24
+
+	selfCopyBufferSize = 1 << 16
+)
+
+type outputHistory struct {
+	window  uint64
+	buffer  []byte
+	written uint64
+}
+
+func newOutputHistory(window uint32) *outputHistory {
+	if window == 0 {
+		return nil
+	}
+	return &outputHistory{window: uint64(window)}
+}
+
+func (h *outputHistory) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if uint64(len(h.buffer)) < h.window {
+			take := h.window - uint64(len(h.buffer))
+			if take > uint64(len(p)) {
+				take = uint64(len(p))
+			}
+			h.buffer = append(h.buffer, p[:take]...)
+			h.written += take
+			p = p[take:]
+			continue
+		}
+		copied := copy(h.buffer[h.written%h.window:], p)
+		h.written += uint64(copied)
+		p = p[copied:]
+	}
+	return n, nil
+}
+
+func (h *outputHistory) read(dst []byte, start uint64) {
+	n := copy(dst, h.buffer[start%h.window:])
+	copy(dst[n:], h.buffer)
+}
+
+func (h *outputHistory) copy(out io.Writer, start, length uint64) error {
+	if start >= h.written || h.written-start > h.window {
+		return fmt.Errorf("corrupted chunk - self copy from offset %d outside of window, written = %d, window = %d", start, h.written, h.window)
+	}
+	buffer := make([]byte, selfCopyBufferSize)
+	for length > 0 {
+		n := length
+		if available := h.written - start; n > available {
+			n = available
+		}
+		if n > uint64(len(buffer)) {
+			n = uint64(len(buffer))
+		}
+		h.read(buffer[:n], start)
+		if _, err := out.Write(buffer[:n]); err != nil {
+			return err
+		}
+		start += n
+		length -= n
+	}
+	return nil
+}
+
+type selfIndexEntry struct {
+	weakSum   uint32
+	strongSum []byte
+}
+
+type selfIndex struct {
+	sig      *Signature
+	entries  []selfIndexEntry
+	offsets  map[uint32][]uint64
+	block    []byte
+	position uint64
+	window   uint64
+}
+
+func newSelfIndex(s *Signature, window uint32) *selfIndex {
+	capacity := window / s.blockLength
+	if capacity == 0 {
+		return nil
+	}
+	return &selfIndex{
+		sig:     s,
+		entries: make([]selfIndexEntry, capacity),
+		offsets: map[uint32][]uint64{},
+		block:   make([]byte, 0, s.blockLength),
+		window:  uint64(window),
+	}
+}
+
+func (x *selfIndex) track(data []byte) {
+	if x == nil {
+		return
+	}
+	for len(data) > 0 {
+		n := copy(x.block[len(x.block):cap(x.block)], data)
+		x.block = x.block[:len(x.block)+n]
+		x.position += uint64(n)
+		data = data[n:]
+		if len(x.block) == cap(x.block) {
+			x.add(x.position - uint64(len(x.block)))
+			x.block = x.block[:0]
+		}
+	}
+}
+
+func (x *selfIndex) add(offset uint64) {
+	blockLen := uint64(x.sig.blockLength)
+	capacity := uint64(len(x.entries))
+	slot := (offset / blockLen) % capacity
+	if offset >= capacity*blockLen {
+		evicted := x.entries[slot]
+		if offsets := x.offsets[evicted.weakSum]; len(offsets) > 1 {
+			x.offsets[evicted.weakSum] = offsets[1:]
+		} else {
+			delete(x.offsets, evicted.weakSum)
+		}
+	}
+	entry := selfIndexEntry{
+		weakSum:   x.sig.computeRollingChecksum(x.block),
+		strongSum: x.sig.computeStrongChecksum(x.block),
+	}
+	x.entries[slot] = entry
+	x.offsets[entry.weakSum] = append(x.offsets[entry.weakSum], offset)
+}
+
+func (x *selfIndex) find(block []byte, weakSum uint32) (uint64, bool) {
+	if x == nil {
+		return 0, false
+	}
+	candidates := x.offsets[weakSum]
+	if len(candidates) == 0 || len(block) != int(x.sig.blockLength) {
+		return 0, false
+	}
+	strongSum := x.sig.computeStrongChecksum(block)
+	for i := len(candidates) - 1; i >= 0 && x.position-candidates[i] <= x.window; i-- {
+		slot := (candidates[i] / uint64(x.sig.blockLength)) % uint64(len(x.entries))
+		if bytes.Equal(x.entries[slot].strongSum, strongSum) {
+			return candidates[i], true
+		}
+	}
+	return 0, false
+}
+
+type selfCopyResolver struct {
+	chunks []chunk
+	ends   []uint64
+}
+
+func (d *Delta) withoutSelfCopies() (*Delta, error) {
+	hasSelfCopies := false
+	for _, c := range d.chunks {
+		if _, ok := c.(*selfCopy); ok {
+			hasSelfCopies = true
+			break
+		}
+	}
+	if !hasSelfCopies {
+		return d, nil
+	}
+	r := &selfCopyResolver{}
+	for _, c := range d.chunks {
+		switch c := c.(type) {
+		case *reusable:
+			r.add(&reusable{startPosition: c.startPosition, length: c.length})
+		case *modified:
+			r.add(&modified{data: c.data[:len(c.data):len(c.data)]})
+		case *selfCopy:
+			if err := r.resolve(c.startPosition, c.length); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Delta{chunks: r.chunks, compression: d.compression, checksum: d.checksum, encoding: d.encoding}, nil
+}
+
+func (r *selfCopyResolver) end() uint64 {
+	if len(r.ends) == 0 {
+		return 0
+	}
+	return r.ends[len(r.ends)-1]
+}
+
+func (r *selfCopyResolver) add(c chunk) {
+	if c.size() == 0 {
+		return
+	}
+	if n := len(r.chunks); n > 0 && r.chunks[n-1].append(c) {
+		r.ends[n-1] += c.size()
+		return
+	}
+	r.ends = append(r.ends, r.end()+c.size())
+	r.chunks = append(r.chunks, c)
+}
+
+func (r *selfCopyResolver) resolve(start, length uint64) error {
+	if start >= r.end() {
+		return fmt.Errorf("corrupted chunk - self copy from offset %d beyond output size %d", start, r.end())
+	}
+	for length > 0 {
+		i := sort.Search(len(r.ends), func(i int) bool { return r.ends[i] > start })
+		skip := start - (r.ends[i] - r.chunks[i].size())
+		n := r.ends[i] - start
+		if n > length {
+			n = length
+		}
+		switch c := r.chunks[i].(type) {
+		case *reusable:
+			r.add(&reusable{startPosition: c.startPosition + skip, length: n})
+		case *modified:
+			data := make([]byte, n)
+			copy(data, c.data[skip:])
+			r.add(&modified{data: data})
+		}
+		start += n
+		length -= n
+	}
+	return nil
+}
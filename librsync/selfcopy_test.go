@@ -0,0 +1,242 @@
+package librsync
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfCopyRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveRandom := make([]byte, 10000)
+	rnd.Read(giveRandom)
+	giveLog := &bytes.Buffer{}
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(giveLog, "level=info msg=\"request handled\" status=200 path=/api/v1/items id=%d\n", i%7)
+	}
+	tests := []struct {
+		desc           string
+		giveOld        []byte
+		giveNew        []byte
+		wantSelfCopies bool
+	}{
+		{desc: "should handle empty basis", giveOld: nil, giveNew: concat(giveRandom[:3000], giveRandom[:3000]), wantSelfCopies: true},
+		{desc: "should handle repeated lines", giveOld: giveRandom[:1000], giveNew: giveLog.Bytes(), wantSelfCopies: true},
+		{desc: "should handle run of a single byte", giveOld: nil, giveNew: bytes.Repeat([]byte{'x'}, 5000), wantSelfCopies: true},
+		{desc: "should prefer basis matches", giveOld: giveRandom, giveNew: concat(giveRandom, giveRandom), wantSelfCopies: false},
+		{desc: "should handle unique content", giveOld: giveRandom[:5000], giveNew: giveRandom[5000:], wantSelfCopies: false},
+		{desc: "should handle empty new file", giveOld: giveRandom, giveNew: nil, wantSelfCopies: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(tc.giveOld), 64)
+			assert.NoError(t, err)
+			delta, err := NewDelta(bytes.NewReader(tc.giveNew), sig, WithSelfCopyWindow(DefaultSelfCopyWindow))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantSelfCopies, delta.Summary().SelfCopiedBytes > 0)
+			assert.Equal(t, uint64(len(tc.giveNew)), delta.Summary().OutputSize())
+
+			out := &bytes.Buffer{}
+			assert.NoError(t, delta.Patch(bytes.NewReader(tc.giveOld), out))
+			assert.Equal(t, tc.giveNew, out.Bytes())
+
+			deltaBuff := &bytes.Buffer{}
+			assert.NoError(t, delta.Write(deltaBuff))
+			readDelta, err := ReadDelta(bytes.NewReader(deltaBuff.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t, delta, readDelta)
+			out.Reset()
+			assert.NoError(t, ApplyPatch(bytes.NewReader(tc.giveOld), deltaBuff, out))
+			assert.Equal(t, tc.giveNew, out.Bytes())
+
+			deltaBuff.Reset()
+			assert.NoError(t, WriteDelta(bytes.NewReader(tc.giveNew), sig, deltaBuff, WithSelfCopyWindow(DefaultSelfCopyWindow)))
+			out.Reset()
+			assert.NoError(t, ApplyPatch(bytes.NewReader(tc.giveOld), deltaBuff, out))
+			assert.Equal(t, tc.giveNew, out.Bytes())
+
+			deltaBuff.Reset()
+			assert.NoError(t, delta.WriteLibrsync(deltaBuff))
+			out.Reset()
+			assert.NoError(t, ApplyLibrsyncPatch(bytes.NewReader(tc.giveOld), deltaBuff, out))
+			assert.Equal(t, tc.giveNew, out.Bytes())
+
+			inverted, err := delta.Invert(bytes.NewReader(tc.giveOld))
+			assert.NoError(t, err)
+			out.Reset()
+			assert.NoError(t, inverted.Patch(bytes.NewReader(tc.giveNew), out))
+			assert.Equal(t, string(tc.giveOld), out.String())
+
+			f := writeTempFile(t, tc.giveOld)
+			assert.NoError(t, delta.PatchInPlace(f))
+			patched, err := os.ReadFile(f.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, string(tc.giveNew), string(patched))
+		})
+	}
+}
+
+func TestSelfCopyChunks(t *testing.T) {
+	tests := []struct {
+		desc       string
+		giveChunks []chunk
+		wantOutput []byte
+		wantChunks []chunk
+	}{
+		{
+			desc:       "should handle overlapping copy",
+			giveChunks: []chunk{&modified{data: []byte("ab")}, &selfCopy{startPosition: 0, length: 7}},
+			wantOutput: []byte("ababababa"),
+			wantChunks: []chunk{&modified{data: []byte("ababababa")}},
+		},
+		{
+			desc: "should handle copy spanning chunks",
+			giveChunks: []chunk{
+				&reusable{startPosition: 2, length: 3},
+				&modified{data: []byte("x")},
+				&selfCopy{startPosition: 1, length: 4},
+			},
+			wantOutput: []byte("234x34x3"),
+			wantChunks: []chunk{
+				&reusable{startPosition: 2, length: 3},
+				&modified{data: []byte("x")},
+				&reusable{startPosition: 3, length: 2},
+				&modified{data: []byte("x")},
+				&reusable{startPosition: 3, length: 1},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			giveDelta := &Delta{chunks: tc.giveChunks, selfWindow: 16}
+
+			out := &bytes.Buffer{}
+			assert.NoError(t, giveDelta.Patch(bytes.NewReader([]byte("0123456789")), out))
+			assert.Equal(t, tc.wantOutput, out.Bytes())
+			gotDelta, err := giveDelta.withoutSelfCopies()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantChunks, gotDelta.chunks)
+		})
+	}
+}
+
+func TestSelfCopyErrors(t *testing.T) {
+	tests := []struct {
+		desc      string
+		giveDelta *Delta
+	}{
+		{
+			desc:      "should reject self copy without window",
+			giveDelta: &Delta{chunks: []chunk{&modified{data: []byte("ab")}, &selfCopy{startPosition: 0, length: 2}}},
+		},
+		{
+			desc:      "should reject self copy of unwritten output",
+			giveDelta: &Delta{chunks: []chunk{&modified{data: []byte("ab")}, &selfCopy{startPosition: 2, length: 2}}, selfWindow: 16},
+		},
+		{
+			desc:      "should reject self copy outside of window",
+			giveDelta: &Delta{chunks: []chunk{&modified{data: []byte("abcdef")}, &selfCopy{startPosition: 0, length: 2}}, selfWindow: 4},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Error(t, tc.giveDelta.Patch(bytes.NewReader(nil), &bytes.Buffer{}))
+		})
+	}
+
+	_, err := (&Delta{chunks: []chunk{&selfCopy{startPosition: 0, length: 2}}}).withoutSelfCopies()
+	assert.Error(t, err)
+	sig, err := NewLibrsyncSignature(bytes.NewReader(nil), 64)
+	assert.NoError(t, err)
+	assert.Error(t, WriteLibrsyncDelta(bytes.NewReader(nil), sig, &bytes.Buffer{}, WithSelfCopyWindow(DefaultSelfCopyWindow)))
+}
+
+func TestSelfCopyWindow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveData := make([]byte, 1064)
+	rnd.Read(giveData)
+	giveNew := concat(giveData, giveData[:64])
+	tests := []struct {
+		desc           string
+		giveWindow     uint32
+		wantSelfCopies uint64
+	}{
+		{desc: "should not index without window", giveWindow: 0, wantSelfCopies: 0},
+		{desc: "should not index window shorter than block", giveWindow: 32, wantSelfCopies: 0},
+		{desc: "should forget blocks outside of window", giveWindow: 512, wantSelfCopies: 0},
+		{desc: "should reuse blocks within window", giveWindow: 2048, wantSelfCopies: 64},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(nil), 64)
+			assert.NoError(t, err)
+			delta, err := NewDelta(bytes.NewReader(giveNew), sig, WithSelfCopyWindow(tc.giveWindow))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantSelfCopies, delta.Summary().SelfCopiedBytes)
+
+			out := &bytes.Buffer{}
+			assert.NoError(t, delta.Patch(bytes.NewReader(nil), out))
+			assert.Equal(t, giveNew, out.Bytes())
+		})
+	}
+}
+
+func TestSelfCopySmallWindow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	giveData := make([]byte, 512)
+	rnd.Read(giveData)
+	tests := []struct {
+		desc         string
+		giveDistance int
+	}{
+		{desc: "should reuse repeat inside window", giveDistance: 56},
+		{desc: "should handle repeat at window edge", giveDistance: 64},
+		{desc: "should handle repeat just outside window", giveDistance: 65},
+		{desc: "should handle repeat within block of window edge", giveDistance: 70},
+		{desc: "should handle repeat a block outside window", giveDistance: 72},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			giveNew := []byte{}
+			for i := 0; i+tc.giveDistance <= len(giveData); i += tc.giveDistance {
+				giveNew = append(giveNew, giveData[i:i+tc.giveDistance]...)
+				giveNew = append(giveNew, giveData[i:i+24]...)
+			}
+			sig, err := NewSignature(bytes.NewReader(nil), 8)
+			assert.NoError(t, err)
+			delta, err := NewDelta(bytes.NewReader(giveNew), sig, WithSelfCopyWindow(64))
+			assert.NoError(t, err)
+			out := &bytes.Buffer{}
+			assert.NoError(t, delta.Patch(bytes.NewReader(nil), out))
+			assert.Equal(t, giveNew, out.Bytes())
+
+			deltaBuff := &bytes.Buffer{}
+			assert.NoError(t, WriteDelta(bytes.NewReader(giveNew), sig, deltaBuff, WithSelfCopyWindow(64)))
+			out.Reset()
+			assert.NoError(t, ApplyPatch(bytes.NewReader(nil), deltaBuff, out))
+			assert.Equal(t, giveNew, out.Bytes())
+		})
+	}
+}
+
+func TestComposeSelfCopies(t *testing.T) {
+	giveBase := []byte("0123456789")
+	giveD1 := &Delta{chunks: []chunk{&reusable{startPosition: 0, length: 4}, &selfCopy{startPosition: 0, length: 4}}, selfWindow: 16}
+	giveD2 := &Delta{chunks: []chunk{&reusable{startPosition: 2, length: 4}, &selfCopy{startPosition: 0, length: 6}}, selfWindow: 16}
+	wantOutput := []byte("2301230123")
+
+	composed, err := Compose(giveD1, giveD2)
+	assert.NoError(t, err)
+	out := &bytes.Buffer{}
+	assert.NoError(t, composed.Patch(bytes.NewReader(giveBase), out))
+	assert.Equal(t, wantOutput, out.Bytes())
+}
@@ -1,90 +1,201 @@
 package librsync
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-
-	"github.com/Pirellik/simple-rdiff/rollsum"
+	"sort"
 )
 
 type Signature struct {
-	blockLength             uint32
-	strongSignatures        [][]byte
-	weakSignaturesToBlockID map[uint32]uint64
+	blockLength              uint32
+	strongLength             uint32
+	strongHash               StrongHash
+	weakHash                 RollingHash
+	strongSignatures         [][]byte
+	weakSignatures           []uint32
+	weakSignaturesToBlockIDs map[uint32][]uint64
+}
+
+type SignatureOption func(*signatureOptions)
+
+type signatureOptions struct {
+	strongHash   StrongHash
+	strongLength uint32
+	weakHash     RollingHash
+	progress     ProgressFunc
+}
+
+func WithStrongHash(h StrongHash) SignatureOption {
+	return func(o *signatureOptions) {
+		o.strongHash = h
+	}
+}
+
+func WithRollingHash(h RollingHash) SignatureOption {
+	return func(o *signatureOptions) {
+		o.weakHash = h
+	}
+}
+
+func WithStrongLength(length uint32) SignatureOption {
+	return func(o *signatureOptions) {
+		o.strongLength = length
+	}
+}
+
+func newSignatureOptions(strongHash StrongHash, weakHash RollingHash, opts []SignatureOption) (signatureOptions, error) {
+	options := signatureOptions{
+		strongHash: strongHash,
+		weakHash:   weakHash,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if !options.strongHash.valid() {
+		return options, fmt.Errorf("unknown strong hash algorithm = %d", options.strongHash)
+	}
+	if !options.weakHash.valid() {
+		return options, fmt.Errorf("unknown rolling hash algorithm = %d", options.weakHash)
+	}
+	if options.strongLength == 0 {
+		options.strongLength = options.strongHash.Size()
+	}
+	if options.strongLength > options.strongHash.Size() {
+		return options, fmt.Errorf("too long strong hash, got = %d, max length = %d", options.strongLength, options.strongHash.Size())
+	}
+	return options, nil
+}
+
+func NewSignature(in io.Reader, blockLen uint32, opts ...SignatureOption) (*Signature, error) {
+	sig, options, err := newSignature(blockLen, SHA256, Rollsum, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := sig.compute(in, newProgressTracker(options.progress)); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func NewLibrsyncSignature(in io.Reader, blockLen uint32, opts ...SignatureOption) (*Signature, error) {
+	sig, options, err := newSignature(blockLen, BLAKE2b, RollsumLibrsync, opts)
+	if err != nil {
+		return nil, err
+	}
+	if sig.strongHash != MD4 && sig.strongHash != BLAKE2b {
+		return nil, fmt.Errorf("strong hash %s is not supported by librsync", sig.strongHash)
+	}
+	if sig.weakHash != RollsumLibrsync && sig.weakHash != RabinKarp {
+		return nil, fmt.Errorf("rolling hash %s is not supported by librsync", sig.weakHash)
+	}
+	if err := sig.compute(in, newProgressTracker(options.progress)); err != nil {
+		return nil, err
+	}
+	return sig, nil
 }
 
-func NewSignature(in io.Reader, blockLen uint32) (*Signature, error) {
-	if blockLen < sha256.Size {
-		return nil, fmt.Errorf("too small block size, min size = %d", sha256.Size)
+func newSignature(blockLen uint32, strongHash StrongHash, weakHash RollingHash, opts []SignatureOption) (*Signature, signatureOptions, error) {
+	if blockLen == 0 {
+		return nil, signatureOptions{}, fmt.Errorf("invalid block size = %d", blockLen)
 	}
-	sig := Signature{
-		blockLength:             blockLen,
-		weakSignaturesToBlockID: make(map[uint32]uint64),
+	options, err := newSignatureOptions(strongHash, weakHash, opts)
+	if err != nil {
+		return nil, options, err
 	}
-	buffer := make([]byte, blockLen)
+	return &Signature{
+		blockLength:  blockLen,
+		strongLength: options.strongLength,
+		strongHash:   options.strongHash,
+		weakHash:     options.weakHash,
+	}, options, nil
+}
+
+func (s *Signature) compute(in io.Reader, progress *progressTracker) error {
+	s.weakSignaturesToBlockIDs = make(map[uint32][]uint64)
+	buffer := make([]byte, s.blockLength)
 
 	for {
-		n, err := in.Read(buffer)
-		if err != nil {
+		n, err := io.ReadFull(in, buffer)
+		if err != nil && err != io.ErrUnexpectedEOF {
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			return err
 		}
 		block := buffer[:n]
-		weakSig := computeRollingChecksum(block)
-		strongSig := computeStrongChecksum(block)
-		sig.weakSignaturesToBlockID[weakSig] = uint64(len(sig.strongSignatures))
-		sig.strongSignatures = append(sig.strongSignatures, strongSig)
+		weakSig := s.computeRollingChecksum(block)
+		strongSig := s.computeStrongChecksum(block)
+		s.addBlock(weakSig, strongSig)
+		progress.scanned(n)
 	}
-	return &sig, nil
+	progress.done()
+	return nil
 }
 
 func ReadSignature(in io.Reader) (*Signature, error) {
-	var blockLength uint32
-	if err := binary.Read(in, binary.BigEndian, &blockLength); err != nil {
+	header, err := readSignatureHeader(in)
+	if err != nil {
 		return nil, err
 	}
-	strongSigs := [][]byte{}
-	weakSigToBlockID := map[uint32]uint64{}
+	sig := &Signature{
+		blockLength:  header.BlockLength,
+		strongLength: uint32(header.StrongLength),
+		strongHash:   StrongHash(header.StrongHash),
+		weakHash:     RollingHash(header.WeakHash),
+	}
+	if err := sig.readBlocks(in); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *Signature) readBlocks(in io.Reader) error {
+	s.strongSignatures = [][]byte{}
+	s.weakSignatures = []uint32{}
+	s.weakSignaturesToBlockIDs = map[uint32][]uint64{}
 	for {
 		var weakSig uint32
 		if err := binary.Read(in, binary.BigEndian, &weakSig); err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			if err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("truncated signature - incomplete weak hash of block %d", len(s.strongSignatures))
+			}
+			return err
 		}
-		strongSig := make([]byte, sha256.Size)
-		n, err := in.Read(strongSig)
-		if err != nil {
-			return nil, err
+		strongSig := make([]byte, s.strongLength)
+		n, err := io.ReadFull(in, strongSig)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
 		}
-		if n != int(sha256.Size) {
-			return nil, fmt.Errorf("too short strong hash, got = %d, want = %d", n, sha256.Size)
+		if n != int(s.strongLength) {
+			return fmt.Errorf("too short strong hash, got = %d, want = %d", n, s.strongLength)
 		}
-		weakSigToBlockID[weakSig] = uint64(len(strongSigs))
-		strongSigs = append(strongSigs, strongSig)
+		s.addBlock(weakSig, strongSig)
 	}
-
-	return &Signature{
-		blockLength:             blockLength,
-		strongSignatures:        strongSigs,
-		weakSignaturesToBlockID: weakSigToBlockID,
-	}, nil
+	return nil
 }
 
 func (s *Signature) Write(out io.Writer) error {
-	if err := binary.Write(out, binary.BigEndian, s.blockLength); err != nil {
-		return err
+	header := signatureHeader{
+		Magic:        signatureMagic,
+		Version:      signatureFormatVersion,
+		StrongHash:   uint8(s.strongHash),
+		StrongLength: uint8(s.strongLength),
+		WeakHash:     uint8(s.weakHash),
+		BlockLength:  s.blockLength,
 	}
-	weakSigs := make([]uint32, len(s.strongSignatures))
-	for sig, ID := range s.weakSignaturesToBlockID {
-		weakSigs[int(ID)] = sig
+	if err := binary.Write(out, binary.BigEndian, header); err != nil {
+		return err
 	}
-	for i, weakSig := range weakSigs {
+	return s.writeBlocks(out)
+}
+
+func (s *Signature) writeBlocks(out io.Writer) error {
+	for i, weakSig := range s.weakSignatures {
 		if err := binary.Write(out, binary.BigEndian, weakSig); err != nil {
 			return err
 		}
@@ -95,14 +206,41 @@ func (s *Signature) Write(out io.Writer) error {
 	return nil
 }
 
-func computeRollingChecksum(in []byte) uint32 {
-	rSum := rollsum.New()
+func (s *Signature) addBlock(weakSig uint32, strongSig []byte) {
+	blockID := uint64(len(s.strongSignatures))
+	s.weakSignaturesToBlockIDs[weakSig] = append(s.weakSignaturesToBlockIDs[weakSig], blockID)
+	s.weakSignatures = append(s.weakSignatures, weakSig)
+	s.strongSignatures = append(s.strongSignatures, strongSig)
+}
+
+func (s *Signature) findBlock(block []byte, weakSum uint32, preferredID uint64, policy MatchPolicy) (uint64, bool) {
+	candidates := s.weakSignaturesToBlockIDs[weakSum]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	strongSum := s.computeStrongChecksum(block)
+	if policy == MatchLocality {
+		i := sort.Search(len(candidates), func(i int) bool { return candidates[i] >= preferredID })
+		if i < len(candidates) && candidates[i] == preferredID && bytes.Equal(s.strongSignatures[preferredID], strongSum) {
+			return preferredID, true
+		}
+	}
+	for _, blockID := range candidates {
+		if bytes.Equal(s.strongSignatures[blockID], strongSum) {
+			return blockID, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Signature) computeRollingChecksum(in []byte) uint32 {
+	rSum := s.weakHash.new()
 	rSum.Init(in)
 	return rSum.Sum()
 }
 
-func computeStrongChecksum(in []byte) []byte {
-	strongHash := sha256.New()
+func (s *Signature) computeStrongChecksum(in []byte) []byte {
+	strongHash := s.strongHash.new()
 	strongHash.Write(in)
-	return strongHash.Sum(nil)
+	return strongHash.Sum(nil)[:s.strongLength]
 }
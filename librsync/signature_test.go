@@ -3,6 +3,7 @@ package librsync
 import (
 	"bytes"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,16 +14,18 @@ func TestNewSignature(t *testing.T) {
 		108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32, 104, 101, 108, 108, 111, 32})
 	giveBlockLength := 32
 	wantSig := &Signature{
-		blockLength: 32,
+		blockLength:  32,
+		strongLength: 32,
 		strongSignatures: [][]byte{
 			{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 			{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 			{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 		},
-		weakSignaturesToBlockID: map[uint32]uint64{
-			16646287:   2,
-			3276082140: 1,
-			3308522449: 0,
+		weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+		weakSignaturesToBlockIDs: map[uint32][]uint64{
+			16646287:   {2},
+			3276082140: {1},
+			3308522449: {0},
 		},
 	}
 
@@ -32,22 +35,24 @@ func TestNewSignature(t *testing.T) {
 }
 
 func TestReadSignature(t *testing.T) {
-	giveBuff := bytes.NewBuffer([]byte{0, 0, 0, 32, 197, 52, 11, 209, 61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2,
+	giveBuff := bytes.NewBuffer([]byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 0, 0, 0, 0, 32, 197, 52, 11, 209, 61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2,
 		184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240, 195, 69, 11, 220,
 		1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85,
 		246, 96, 23, 101, 215, 125, 41, 0, 254, 0, 143, 134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87,
 		193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28})
 	wantSig := &Signature{
-		blockLength: 32,
+		blockLength:  32,
+		strongLength: 32,
 		strongSignatures: [][]byte{
 			{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 			{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 			{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 		},
-		weakSignaturesToBlockID: map[uint32]uint64{
-			16646287:   2,
-			3276082140: 1,
-			3308522449: 0,
+		weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+		weakSignaturesToBlockIDs: map[uint32][]uint64{
+			16646287:   {2},
+			3276082140: {1},
+			3308522449: {0},
 		},
 	}
 
@@ -58,19 +63,21 @@ func TestReadSignature(t *testing.T) {
 
 func TestSignatureWrite(t *testing.T) {
 	giveSig := &Signature{
-		blockLength: 32,
+		blockLength:  32,
+		strongLength: 32,
 		strongSignatures: [][]byte{
 			{61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2, 184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240},
 			{1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85, 246, 96, 23, 101, 215, 125, 41},
 			{134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87, 193, 5, 129, 20, 56, 212, 158, 60, 234, 21, 240, 68, 11, 190, 154, 195, 62, 165, 28},
 		},
-		weakSignaturesToBlockID: map[uint32]uint64{
-			16646287:   2,
-			3276082140: 1,
-			3308522449: 0,
+		weakSignatures: []uint32{3308522449, 3276082140, 16646287},
+		weakSignaturesToBlockIDs: map[uint32][]uint64{
+			16646287:   {2},
+			3276082140: {1},
+			3308522449: {0},
 		},
 	}
-	wantBuff := bytes.NewBuffer([]byte{0, 0, 0, 32, 197, 52, 11, 209, 61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2,
+	wantBuff := bytes.NewBuffer([]byte{0x72, 0x64, 0x73, 0x67, 1, 0, 32, 0, 0, 0, 0, 32, 197, 52, 11, 209, 61, 7, 188, 146, 183, 66, 102, 5, 216, 249, 196, 2,
 		184, 114, 200, 118, 207, 233, 146, 244, 196, 82, 188, 82, 74, 178, 66, 250, 206, 163, 215, 240, 195, 69, 11, 220,
 		1, 84, 112, 6, 249, 182, 164, 120, 200, 26, 252, 211, 98, 67, 127, 254, 81, 223, 36, 86, 194, 26, 205, 54, 85,
 		246, 96, 23, 101, 215, 125, 41, 0, 254, 0, 143, 134, 176, 225, 187, 226, 118, 88, 57, 49, 158, 133, 226, 87,
@@ -81,3 +88,125 @@ func TestSignatureWrite(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, wantBuff, gotBuff)
 }
+
+func TestNewSignatureWithStrongHash(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	giveNew := []byte("the quick brown fox jumped over the lazy dog; pack my box with five dozen liquor jugs!")
+
+	for _, h := range []StrongHash{SHA256, MD4, BLAKE2b, SHA512_256, MD5, FNV128} {
+		t.Run(h.String(), func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(giveBase), 8, WithStrongHash(h), WithStrongLength(6))
+			assert.NoError(t, err)
+			assert.Equal(t, h, sig.strongHash)
+			assert.Equal(t, uint32(6), sig.strongLength)
+			assert.Len(t, sig.strongSignatures, 11)
+			for _, strongSig := range sig.strongSignatures {
+				assert.Len(t, strongSig, 6)
+			}
+
+			sigBuff := &bytes.Buffer{}
+			assert.NoError(t, sig.Write(sigBuff))
+			gotSig, err := ReadSignature(sigBuff)
+			assert.NoError(t, err)
+			assert.Equal(t, sig, gotSig)
+
+			delta, err := NewDelta(bytes.NewReader(giveNew), gotSig)
+			assert.NoError(t, err)
+			gotBuff := &bytes.Buffer{}
+			assert.NoError(t, delta.Patch(bytes.NewReader(giveBase), gotBuff))
+			assert.Equal(t, giveNew, gotBuff.Bytes())
+		})
+	}
+}
+
+func TestNewSignatureErrors(t *testing.T) {
+	tests := []struct {
+		desc         string
+		giveBlockLen uint32
+		giveOpts     []SignatureOption
+	}{
+		{desc: "should reject zero block size", giveBlockLen: 0},
+		{desc: "should reject unknown strong hash", giveBlockLen: 32, giveOpts: []SignatureOption{WithStrongHash(StrongHash(99))}},
+		{desc: "should reject too long strong hash", giveBlockLen: 32, giveOpts: []SignatureOption{WithStrongHash(MD5), WithStrongLength(17)}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewSignature(bytes.NewReader([]byte("hello")), tc.giveBlockLen, tc.giveOpts...)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseStrongHash(t *testing.T) {
+	for _, h := range []StrongHash{SHA256, MD4, BLAKE2b, SHA512_256, MD5, FNV128} {
+		got, err := ParseStrongHash(h.String())
+		assert.NoError(t, err)
+		assert.Equal(t, h, got)
+	}
+	_, err := ParseStrongHash("crc32")
+	assert.Error(t, err)
+}
+
+func TestSignatureWithWeakCollisions(t *testing.T) {
+	giveBase := append(bytes.Repeat([]byte{0}, 24), []byte("tail")...)
+
+	sig, err := NewSignature(bytes.NewReader(giveBase), 8, WithStrongLength(4))
+	assert.NoError(t, err)
+	assert.Len(t, sig.weakSignatures, 4)
+	assert.Equal(t, []uint64{0, 1, 2}, sig.weakSignaturesToBlockIDs[sig.weakSignatures[0]])
+
+	sigBuff := &bytes.Buffer{}
+	assert.NoError(t, sig.Write(sigBuff))
+	gotSig, err := ReadSignature(sigBuff)
+	assert.NoError(t, err)
+	assert.Equal(t, sig.weakSignatures, gotSig.weakSignatures)
+	assert.Equal(t, sig.strongSignatures, gotSig.strongSignatures)
+	assert.Equal(t, sig.weakSignaturesToBlockIDs, gotSig.weakSignaturesToBlockIDs)
+}
+
+func TestNewSignatureShortReads(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+
+	wantSig, err := NewSignature(bytes.NewReader(giveBase), 16)
+	assert.NoError(t, err)
+	gotSig, err := NewSignature(iotest.HalfReader(bytes.NewReader(giveBase)), 16)
+	assert.NoError(t, err)
+	assert.Equal(t, wantSig, gotSig)
+}
+
+func TestNewSignatureWithRollingHash(t *testing.T) {
+	giveBase := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	giveNew := []byte("the quick brown fox jumped over the lazy dog; pack my box with five dozen liquor jugs!")
+
+	for _, h := range []RollingHash{Rollsum, RollsumLibrsync, RabinKarp, Buzhash, Gear} {
+		t.Run(h.String(), func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(giveBase), 8, WithRollingHash(h))
+			assert.NoError(t, err)
+			assert.Equal(t, h, sig.weakHash)
+
+			sigBuff := &bytes.Buffer{}
+			assert.NoError(t, sig.Write(sigBuff))
+			gotSig, err := ReadSignature(sigBuff)
+			assert.NoError(t, err)
+			assert.Equal(t, sig, gotSig)
+
+			delta, err := NewDelta(bytes.NewReader(giveNew), gotSig)
+			assert.NoError(t, err)
+			assert.Equal(t, &reusable{startPosition: 32, length: 48}, delta.chunks[2])
+			gotBuff := &bytes.Buffer{}
+			assert.NoError(t, delta.Patch(bytes.NewReader(giveBase), gotBuff))
+			assert.Equal(t, giveNew, gotBuff.Bytes())
+		})
+	}
+}
+
+func TestParseRollingHash(t *testing.T) {
+	for _, h := range []RollingHash{Rollsum, RollsumLibrsync, RabinKarp, Buzhash, Gear} {
+		got, err := ParseRollingHash(h.String())
+		assert.NoError(t, err)
+		assert.Equal(t, h, got)
+	}
+	_, err := ParseRollingHash("adler32")
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+package netsync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+func Pull(addr, remotePath, localPath string, blockLen uint32, opts ...librsync.SignatureOption) error {
+	return PullContext(context.Background(), addr, remotePath, localPath, blockLen, opts...)
+}
+
+func PullContext(ctx context.Context, addr, remotePath, localPath string, blockLen uint32, opts ...librsync.SignatureOption) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	var basis io.ReadSeeker = bytes.NewReader(nil)
+	mode := os.FileMode(0644)
+	local, err := os.Open(localPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer local.Close()
+		info, err := local.Stat()
+		if err != nil {
+			return err
+		}
+		basis, mode = local, info.Mode().Perm()
+	}
+	out, err := ioutil.TempFile(filepath.Dir(localPath), "."+filepath.Base(localPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if err := pullConn(ctx, conn, remotePath, basis, out, blockLen, opts...); err != nil {
+		out.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if err := out.Chmod(mode); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), localPath)
+}
+
+func PullConn(conn io.ReadWriter, remotePath string, basis io.ReadSeeker, out io.Writer, blockLen uint32, opts ...librsync.SignatureOption) error {
+	return pullConn(context.Background(), conn, remotePath, basis, out, blockLen, opts...)
+}
+
+func pullConn(ctx context.Context, conn io.ReadWriter, remotePath string, basis io.ReadSeeker, out io.Writer, blockLen uint32, opts ...librsync.SignatureOption) error {
+	in := bufio.NewReader(conn)
+	bufConn := bufio.NewWriter(conn)
+	if err := writeHello(bufConn); err != nil {
+		return err
+	}
+	if err := writeFrame(bufConn, msgPull, []byte(remotePath)); err != nil {
+		return err
+	}
+	if err := bufConn.Flush(); err != nil {
+		return err
+	}
+	if _, err := readHello(in); err != nil {
+		return err
+	}
+	if _, err := expectFrame(in, msgAccept); err != nil {
+		return err
+	}
+
+	if blockLen == 0 {
+		size, err := basis.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		blockLen = librsync.AutoBlockLength(size)
+	}
+	if _, err := basis.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	sig, err := librsync.NewSignatureContext(ctx, basis, blockLen, opts...)
+	if err != nil {
+		return err
+	}
+	sigOut := &frameWriter{out: bufConn}
+	if err := sig.Write(sigOut); err != nil {
+		return err
+	}
+	if err := sigOut.Close(); err != nil {
+		return err
+	}
+	if err := bufConn.Flush(); err != nil {
+		return err
+	}
+
+	deltaIn := &frameReader{in: in}
+	if err := librsync.ApplyPatchContext(ctx, basis, deltaIn, out); err != nil {
+		return err
+	}
+	return deltaIn.drain()
+}
@@ -0,0 +1,199 @@
+package netsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	protocolMagic   uint32 = 0x7264736e
+	protocolVersion uint8  = 1
+
+	maxFrameSize  = 1 << 20
+	dataFrameSize = 1 << 16
+)
+
+type messageType uint8
+
+const (
+	msgHello messageType = iota + 1
+	msgPull
+	msgAccept
+	msgData
+	msgEnd
+	msgError
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+type frameHeader struct {
+	Type   messageType
+	Length uint32
+}
+
+type hello struct {
+	Magic   uint32
+	Version uint8
+}
+
+func writeFrame(out io.Writer, t messageType, payload []byte) error {
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("%w: too big frame, got = %d, max = %d", ErrProtocol, len(payload), maxFrameSize)
+	}
+	if err := binary.Write(out, binary.BigEndian, frameHeader{Type: t, Length: uint32(len(payload))}); err != nil {
+		return err
+	}
+	_, err := out.Write(payload)
+	return err
+}
+
+func readFrame(in io.Reader) (messageType, []byte, error) {
+	header := frameHeader{}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		if err == io.EOF {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	if header.Length > maxFrameSize {
+		return 0, nil, fmt.Errorf("%w: too big frame, got = %d, max = %d", ErrProtocol, header.Length, maxFrameSize)
+	}
+	payload := make([]byte, header.Length)
+	if _, err := io.ReadFull(in, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	if header.Type == msgError {
+		return 0, nil, &RemoteError{Message: string(payload)}
+	}
+	return header.Type, payload, nil
+}
+
+func expectFrame(in io.Reader, want messageType) ([]byte, error) {
+	t, payload, err := readFrame(in)
+	if err != nil {
+		return nil, err
+	}
+	if t != want {
+		return nil, fmt.Errorf("%w: unexpected message type = %d, want = %d", ErrProtocol, t, want)
+	}
+	return payload, nil
+}
+
+func writeHello(out io.Writer) error {
+	payload := make([]byte, 5)
+	binary.BigEndian.PutUint32(payload, protocolMagic)
+	payload[4] = protocolVersion
+	return writeFrame(out, msgHello, payload)
+}
+
+func readHello(in io.Reader) (*hello, error) {
+	payload, err := expectFrame(in, msgHello)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < 5 {
+		return nil, fmt.Errorf("%w: too short hello, got = %d bytes", ErrProtocol, len(payload))
+	}
+	h := &hello{Magic: binary.BigEndian.Uint32(payload), Version: payload[4]}
+	if h.Magic != protocolMagic {
+		return nil, fmt.Errorf("%w: invalid magic number, got = %#x, want = %#x", ErrProtocol, h.Magic, protocolMagic)
+	}
+	if h.Version == 0 || h.Version > protocolVersion {
+		return nil, fmt.Errorf("%w: unsupported version, got = %d, max supported = %d", ErrProtocol, h.Version, protocolVersion)
+	}
+	return h, nil
+}
+
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote: " + e.Message
+}
+
+type frameWriter struct {
+	out    io.Writer
+	buffer []byte
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.buffer == nil {
+			w.buffer = make([]byte, 0, dataFrameSize)
+		}
+		n := copy(w.buffer[len(w.buffer):cap(w.buffer)], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		written += n
+		p = p[n:]
+		if len(w.buffer) == cap(w.buffer) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *frameWriter) flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	err := writeFrame(w.out, msgData, w.buffer)
+	w.buffer = w.buffer[:0]
+	return err
+}
+
+func (w *frameWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return writeFrame(w.out, msgEnd, nil)
+}
+
+type frameReader struct {
+	in      io.Reader
+	pending []byte
+	done    bool
+	limit   int64
+	read    int64
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		t, payload, err := readFrame(r.in)
+		if err != nil {
+			return 0, err
+		}
+		switch t {
+		case msgData:
+			r.read += int64(len(payload))
+			if r.limit > 0 && r.read > r.limit {
+				return 0, fmt.Errorf("%w: too big data stream, max = %d bytes", ErrProtocol, r.limit)
+			}
+			r.pending = payload
+		case msgEnd:
+			r.done = true
+		default:
+			return 0, fmt.Errorf("%w: unexpected message type = %d in data stream", ErrProtocol, t)
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *frameReader) drain() error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
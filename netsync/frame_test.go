@@ -0,0 +1,97 @@
+package netsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameStreamRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc     string
+		giveSize int
+	}{
+		{desc: "should handle empty stream", giveSize: 0},
+		{desc: "should handle single frame", giveSize: 100},
+		{desc: "should handle exact frame size", giveSize: dataFrameSize},
+		{desc: "should handle many frames", giveSize: 5*dataFrameSize + 17},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			giveData := make([]byte, tc.giveSize)
+			rand.New(rand.NewSource(1)).Read(giveData)
+			buff := &bytes.Buffer{}
+			w := &frameWriter{out: buff}
+			for i := 0; i < len(giveData); i += 1000 {
+				end := i + 1000
+				if end > len(giveData) {
+					end = len(giveData)
+				}
+				_, err := w.Write(giveData[i:end])
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, w.Close())
+
+			got, err := ioutil.ReadAll(&frameReader{in: buff})
+			assert.NoError(t, err)
+			assert.Equal(t, len(giveData), len(got))
+			assert.True(t, bytes.Equal(giveData, got))
+			assert.Equal(t, 0, buff.Len())
+		})
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	remote := &bytes.Buffer{}
+	assert.NoError(t, writeFrame(remote, msgData, []byte("partial")))
+	assert.NoError(t, writeFrame(remote, msgError, []byte("file not found")))
+	unexpected := &bytes.Buffer{}
+	assert.NoError(t, writeFrame(unexpected, msgHello, nil))
+	tooBig := &bytes.Buffer{}
+	assert.NoError(t, binary.Write(tooBig, binary.BigEndian, frameHeader{Type: msgData, Length: maxFrameSize + 1}))
+	truncated := &bytes.Buffer{}
+	assert.NoError(t, writeFrame(truncated, msgData, []byte("data")))
+	truncated.Truncate(truncated.Len() - 1)
+
+	tests := []struct {
+		desc      string
+		giveInput *bytes.Buffer
+		wantErr   error
+	}{
+		{desc: "should return remote error", giveInput: remote, wantErr: &RemoteError{Message: "file not found"}},
+		{desc: "should reject unexpected message", giveInput: unexpected, wantErr: ErrProtocol},
+		{desc: "should reject too big frame", giveInput: tooBig, wantErr: ErrProtocol},
+		{desc: "should reject truncated frame", giveInput: truncated, wantErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ioutil.ReadAll(&frameReader{in: tc.giveInput})
+			if remoteErr, ok := tc.wantErr.(*RemoteError); ok {
+				assert.Equal(t, remoteErr, err)
+			} else {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadHelloErrors(t *testing.T) {
+	badMagic := &bytes.Buffer{}
+	assert.NoError(t, writeFrame(badMagic, msgHello, []byte{0, 0, 0, 0, 1}))
+	badVersion := &bytes.Buffer{}
+	assert.NoError(t, writeFrame(badVersion, msgHello, []byte{0x72, 0x64, 0x73, 0x6e, 99}))
+	tooShort := &bytes.Buffer{}
+	assert.NoError(t, writeFrame(tooShort, msgHello, []byte{0x72}))
+
+	for _, in := range []*bytes.Buffer{badMagic, badVersion, tooShort} {
+		_, err := readHello(in)
+		assert.ErrorIs(t, err, ErrProtocol)
+	}
+}
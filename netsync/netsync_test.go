@@ -0,0 +1,196 @@
+package netsync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+	"github.com/stretchr/testify/assert"
+)
+
+func startServer(t *testing.T, root string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	server := NewServer(root, librsync.WithCompression(librsync.CompressionDeflate))
+	go server.Serve(l)
+	return l.Addr().String()
+}
+
+func TestPull(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveRemote := make([]byte, 200000)
+	rnd.Read(giveRemote)
+	remoteRoot := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(remoteRoot, "sub"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(remoteRoot, "sub", "file"), giveRemote, 0644))
+	addr := startServer(t, remoteRoot)
+
+	tests := []struct {
+		desc       string
+		giveLocal  []byte
+		giveExists bool
+		giveMode   os.FileMode
+		wantMode   os.FileMode
+	}{
+		{desc: "should pull missing file", wantMode: 0644},
+		{desc: "should pull over empty file", giveExists: true, giveMode: 0644, wantMode: 0644},
+		{desc: "should pull over outdated file", giveLocal: concat(giveRemote[:50000], []byte("local change"), giveRemote[60000:]), giveExists: true, giveMode: 0644, wantMode: 0644},
+		{desc: "should pull over identical file", giveLocal: giveRemote, giveExists: true, giveMode: 0644, wantMode: 0644},
+		{desc: "should keep mode of existing file", giveLocal: giveRemote[:1000], giveExists: true, giveMode: 0750, wantMode: 0750},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			localPath := filepath.Join(t.TempDir(), "local")
+			if tc.giveExists {
+				assert.NoError(t, ioutil.WriteFile(localPath, tc.giveLocal, tc.giveMode))
+				assert.NoError(t, os.Chmod(localPath, tc.giveMode))
+			}
+
+			assert.NoError(t, Pull(addr, "sub/file", localPath, 0))
+			got, err := ioutil.ReadFile(localPath)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(giveRemote, got))
+			info, err := os.Stat(localPath)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantMode, info.Mode().Perm())
+			entries, err := ioutil.ReadDir(filepath.Dir(localPath))
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func TestPullErrors(t *testing.T) {
+	remoteRoot := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(remoteRoot, "dir"), 0755))
+	outside := filepath.Join(filepath.Dir(remoteRoot), "outside")
+	assert.NoError(t, ioutil.WriteFile(outside, []byte("secret"), 0644))
+	defer os.Remove(outside)
+	assert.NoError(t, os.Symlink(outside, filepath.Join(remoteRoot, "link")))
+	addr := startServer(t, remoteRoot)
+
+	tests := []struct {
+		desc           string
+		giveRemotePath string
+	}{
+		{desc: "should report missing file", giveRemotePath: "missing"},
+		{desc: "should reject directory", giveRemotePath: "dir"},
+		{desc: "should stay inside root", giveRemotePath: "../outside"},
+		{desc: "should not follow symlink outside root", giveRemotePath: "link"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			localPath := filepath.Join(t.TempDir(), "local")
+			assert.NoError(t, ioutil.WriteFile(localPath, []byte("keep"), 0644))
+
+			err := Pull(addr, tc.giveRemotePath, localPath, 0)
+			assert.IsType(t, &RemoteError{}, err)
+			got, err := ioutil.ReadFile(localPath)
+			assert.NoError(t, err)
+			assert.Equal(t, "keep", string(got))
+		})
+	}
+}
+
+func TestPullSignatureLimit(t *testing.T) {
+	remoteRoot := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(remoteRoot, "file"), make([]byte, 100000), 0644))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	server := NewServer(remoteRoot)
+	server.MaxSignatureSize = 1000
+	go server.Serve(l)
+
+	localPath := filepath.Join(t.TempDir(), "local")
+	assert.NoError(t, ioutil.WriteFile(localPath, make([]byte, 100000), 0644))
+	err = Pull(l.Addr().String(), "file", localPath, 64)
+	if assert.IsType(t, &RemoteError{}, err) {
+		assert.Contains(t, err.Error(), "too big data stream")
+	}
+}
+
+func TestPullContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(ioutil.Discard, conn)
+		}
+	}()
+	localPath := filepath.Join(t.TempDir(), "local")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = PullContext(ctx, l.Addr().String(), "file", localPath, 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	entries, err := ioutil.ReadDir(filepath.Dir(localPath))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestServeContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "file"), []byte("content"), 0644))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- NewServer(root).ServeContext(ctx, l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, writeHello(conn))
+	assert.NoError(t, writeFrame(conn, msgPull, []byte("file")))
+	in := bufio.NewReader(conn)
+	_, err = readHello(in)
+	assert.NoError(t, err)
+	_, err = expectFrame(in, msgAccept)
+	assert.NoError(t, err)
+
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.Copy(ioutil.Discard, in)
+	assert.NoError(t, err)
+}
+
+func TestServeConnRejectsVersion(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	s := NewServer(t.TempDir())
+	go func() {
+		defer server.Close()
+		s.ServeConn(server)
+	}()
+
+	go writeFrame(client, msgHello, []byte{0x72, 0x64, 0x73, 0x6e, 99})
+	_, err := readHello(client)
+	assert.IsType(t, &RemoteError{}, err)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package netsync
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+const DefaultMaxSignatureSize int64 = 16 << 20
+
+type Server struct {
+	root             string
+	deltaOpts        []librsync.DeltaOption
+	ErrorLog         func(error)
+	MaxSignatureSize int64
+}
+
+func NewServer(root string, opts ...librsync.DeltaOption) *Server {
+	return &Server{root: root, deltaOpts: opts, MaxSignatureSize: DefaultMaxSignatureSize}
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	return s.ServeContext(context.Background(), l)
+}
+
+func (s *Server) ServeContext(ctx context.Context, l net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-done:
+		}
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := s.serveConn(ctx, conn); err != nil && s.ErrorLog != nil {
+				s.ErrorLog(fmt.Errorf("%s: %w", conn.RemoteAddr(), err))
+			}
+		}()
+	}
+}
+
+func (s *Server) ServeConn(conn io.ReadWriter) error {
+	return s.ServeConnContext(context.Background(), conn)
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return s.ServeConnContext(ctx, conn)
+}
+
+func (s *Server) ServeConnContext(ctx context.Context, conn io.ReadWriter) error {
+	in := bufio.NewReader(conn)
+	out := bufio.NewWriter(conn)
+	if _, err := readHello(in); err != nil {
+		return sendError(out, err)
+	}
+	if err := writeHello(out); err != nil {
+		return err
+	}
+	remotePath, err := expectFrame(in, msgPull)
+	if err != nil {
+		return sendError(out, err)
+	}
+	filePath, err := s.resolve(string(remotePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sendError(out, fmt.Errorf("%s: no such file", remotePath))
+		}
+		return sendError(out, err)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sendError(out, fmt.Errorf("%s: no such file", remotePath))
+		}
+		return sendError(out, fmt.Errorf("%s: cannot open file", remotePath))
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return sendError(out, err)
+	} else if !info.Mode().IsRegular() {
+		return sendError(out, fmt.Errorf("%s is not a regular file", remotePath))
+	}
+	if err := writeFrame(out, msgAccept, nil); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	sigIn := &frameReader{in: in, limit: s.MaxSignatureSize}
+	sig, err := librsync.ReadSignature(sigIn)
+	if err != nil {
+		return sendError(out, err)
+	}
+	if err := sigIn.drain(); err != nil {
+		return sendError(out, err)
+	}
+	deltaOut := &frameWriter{out: out}
+	if err := librsync.WriteDeltaContext(ctx, f, sig, deltaOut, s.deltaOpts...); err != nil {
+		return sendError(out, err)
+	}
+	if err := deltaOut.Close(); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (s *Server) resolve(name string) (string, error) {
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s resolves outside of served directory", name)
+	}
+	return resolved, nil
+}
+
+func sendError(out *bufio.Writer, err error) error {
+	if werr := writeFrame(out, msgError, []byte(err.Error())); werr != nil {
+		return err
+	}
+	out.Flush()
+	return err
+}
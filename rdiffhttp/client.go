@@ -0,0 +1,88 @@
+package rdiffhttp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+type Client struct {
+	baseURL    string
+	HTTPClient *http.Client
+}
+
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+func (c *Client) Signature(name string) (*librsync.Signature, error) {
+	resp, err := c.HTTPClient.Get(c.url(sigPrefix, name))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return librsync.NewSignature(bytes.NewReader(nil), librsync.DefaultBlockLength)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	return librsync.ReadSignature(bufio.NewReader(resp.Body))
+}
+
+func (c *Client) Push(localPath, name string, opts ...librsync.DeltaOption) error {
+	sig, err := c.Signature(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	body, bodyWriter := io.Pipe()
+	go func() {
+		bodyWriter.CloseWithError(librsync.WriteDelta(f, sig, bodyWriter, opts...))
+	}()
+	defer body.Close()
+	resp, err := c.HTTPClient.Post(c.url(deltaPrefix, name), "application/octet-stream", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return nil
+}
+
+func (c *Client) url(prefix, name string) string {
+	segments := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return c.baseURL + prefix + strings.Join(segments, "/")
+}
+
+func statusError(resp *http.Response) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+}
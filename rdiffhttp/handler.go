@@ -0,0 +1,209 @@
+package rdiffhttp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+const (
+	sigPrefix   = "/sig/"
+	deltaPrefix = "/delta/"
+
+	DefaultMaxDeltaSize int64 = 64 << 20
+	DefaultMaxFileSize  int64 = 1 << 30
+)
+
+var errFileTooLarge = errors.New("patched file too large")
+
+type Handler struct {
+	root         string
+	sigOpts      []librsync.SignatureOption
+	MaxDeltaSize int64
+	MaxFileSize  int64
+}
+
+func NewHandler(root string, opts ...librsync.SignatureOption) *Handler {
+	return &Handler{root: root, sigOpts: opts, MaxDeltaSize: DefaultMaxDeltaSize, MaxFileSize: DefaultMaxFileSize}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, sigPrefix):
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.serveSignature(w, r, strings.TrimPrefix(r.URL.Path, sigPrefix))
+	case strings.HasPrefix(r.URL.Path, deltaPrefix):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.applyDelta(w, r, strings.TrimPrefix(r.URL.Path, deltaPrefix))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) resolve(name string) (string, bool) {
+	if name == "" || strings.HasSuffix(name, "/") {
+		return "", false
+	}
+	return filepath.Join(h.root, filepath.FromSlash(path.Clean("/"+name))), true
+}
+
+func (h *Handler) serveSignature(w http.ResponseWriter, r *http.Request, name string) {
+	filePath, ok := h.resolve(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		writeOpenError(w, r, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	sig, err := librsync.NewSignature(f, librsync.AutoBlockLength(info.Size()), h.sigOpts...)
+	if err != nil {
+		http.Error(w, "cannot compute signature", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if r.Method == http.MethodHead {
+		return
+	}
+	bufOut := bufio.NewWriter(w)
+	if err := sig.Write(bufOut); err != nil {
+		return
+	}
+	bufOut.Flush()
+}
+
+func (h *Handler) applyDelta(w http.ResponseWriter, r *http.Request, name string) {
+	filePath, ok := h.resolve(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body := r.Body
+	if h.MaxDeltaSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.MaxDeltaSize)
+	}
+	delta, err := librsync.ReadDelta(bufio.NewReader(body), librsync.WithLiteralLimit(h.MaxFileSize))
+	if errors.Is(err, librsync.ErrLiteralLimit) {
+		http.Error(w, "patched file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid delta: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var base io.ReadSeeker = bytes.NewReader(nil)
+	mode := os.FileMode(0644)
+	f, err := os.Open(filePath)
+	switch {
+	case err == nil:
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			http.Error(w, "not a regular file", http.StatusConflict)
+			return
+		}
+		base, mode = f, info.Mode().Perm()
+	case !os.IsNotExist(err):
+		writeOpenError(w, r, err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		http.Error(w, "cannot create directory", http.StatusInternalServerError)
+		return
+	}
+	write := func(out io.Writer) error {
+		if h.MaxFileSize > 0 {
+			out = &limitedWriter{out: out, remaining: h.MaxFileSize}
+		}
+		return delta.Patch(base, out)
+	}
+	if err := replaceFile(filePath, mode, write); err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			http.Error(w, "patched file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, librsync.ErrChecksumMismatch) || errors.Is(err, io.ErrUnexpectedEOF) {
+			http.Error(w, "delta does not match current file: "+err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "cannot apply delta", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func replaceFile(filePath string, mode os.FileMode, write func(io.Writer) error) error {
+	out, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	bufOut := bufio.NewWriter(out)
+	if err := write(bufOut); err != nil {
+		out.Close()
+		return err
+	}
+	if err := bufOut.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Chmod(mode); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), filePath)
+}
+
+type limitedWriter struct {
+	out       io.Writer
+	remaining int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.remaining {
+		return 0, errFileTooLarge
+	}
+	w.remaining -= int64(len(p))
+	return w.out.Write(p)
+}
+
+func writeOpenError(w http.ResponseWriter, r *http.Request, err error) {
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if os.IsPermission(err) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	http.Error(w, "cannot open file", http.StatusInternalServerError)
+}
@@ -0,0 +1,164 @@
+package rdiffhttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPush(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	giveLocal := make([]byte, 200000)
+	rnd.Read(giveLocal)
+	tests := []struct {
+		desc       string
+		giveName   string
+		giveRemote []byte
+		giveMode   os.FileMode
+	}{
+		{desc: "should create missing file", giveName: "dir/new file"},
+		{desc: "should update outdated file", giveName: "outdated", giveRemote: append(append([]byte(nil), giveLocal[:100000]...), giveLocal[100100:]...), giveMode: 0600},
+		{desc: "should keep identical file", giveName: "identical", giveRemote: giveLocal, giveMode: 0640},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			root := t.TempDir()
+			remotePath := filepath.Join(root, filepath.FromSlash(tc.giveName))
+			wantMode := os.FileMode(0644)
+			if tc.giveRemote != nil {
+				assert.NoError(t, ioutil.WriteFile(remotePath, tc.giveRemote, 0644))
+				assert.NoError(t, os.Chmod(remotePath, tc.giveMode))
+				wantMode = tc.giveMode
+			}
+			localPath := filepath.Join(t.TempDir(), "local")
+			assert.NoError(t, ioutil.WriteFile(localPath, giveLocal, 0644))
+			server := httptest.NewServer(NewHandler(root))
+			defer server.Close()
+
+			assert.NoError(t, NewClient(server.URL).Push(localPath, tc.giveName, librsync.WithCompression(librsync.CompressionDeflate)))
+			got, err := ioutil.ReadFile(remotePath)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(giveLocal, got))
+			info, err := os.Stat(remotePath)
+			assert.NoError(t, err)
+			assert.Equal(t, wantMode, info.Mode().Perm())
+			entries, err := ioutil.ReadDir(filepath.Dir(remotePath))
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "file"), []byte("remote content"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(filepath.Dir(root), "outside"), []byte("secret"), 0644))
+	mismatched := &bytes.Buffer{}
+	sig, err := librsync.NewSignature(bytes.NewReader([]byte("other content")), 4)
+	assert.NoError(t, err)
+	assert.NoError(t, librsync.WriteDelta(bytes.NewReader([]byte("other content!")), sig, mismatched))
+	server := httptest.NewServer(NewHandler(root))
+	defer server.Close()
+
+	tests := []struct {
+		desc       string
+		giveMethod string
+		givePath   string
+		giveBody   []byte
+		wantStatus int
+	}{
+		{desc: "should serve signature", giveMethod: http.MethodGet, givePath: "/sig/file", wantStatus: http.StatusOK},
+		{desc: "should report missing file", giveMethod: http.MethodGet, givePath: "/sig/missing", wantStatus: http.StatusNotFound},
+		{desc: "should not sign directory", giveMethod: http.MethodGet, givePath: "/sig/dir", wantStatus: http.StatusNotFound},
+		{desc: "should stay inside root", giveMethod: http.MethodGet, givePath: "/sig/%2e%2e/outside", wantStatus: http.StatusNotFound},
+		{desc: "should reject unknown path", giveMethod: http.MethodGet, givePath: "/other/file", wantStatus: http.StatusNotFound},
+		{desc: "should reject wrong signature method", giveMethod: http.MethodPost, givePath: "/sig/file", wantStatus: http.StatusMethodNotAllowed},
+		{desc: "should reject wrong delta method", giveMethod: http.MethodGet, givePath: "/delta/file", wantStatus: http.StatusMethodNotAllowed},
+		{desc: "should reject corrupted delta", giveMethod: http.MethodPost, givePath: "/delta/file", giveBody: []byte("garbage"), wantStatus: http.StatusBadRequest},
+		{desc: "should reject delta for other basis", giveMethod: http.MethodPost, givePath: "/delta/file", giveBody: mismatched.Bytes(), wantStatus: http.StatusConflict},
+		{desc: "should reject delta for directory", giveMethod: http.MethodPost, givePath: "/delta/dir", giveBody: mismatched.Bytes(), wantStatus: http.StatusConflict},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := http.NewRequest(tc.giveMethod, server.URL+tc.givePath, bytes.NewReader(tc.giveBody))
+			assert.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+
+			got, err := ioutil.ReadFile(filepath.Join(root, "file"))
+			assert.NoError(t, err)
+			assert.Equal(t, "remote content", string(got))
+		})
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	root := t.TempDir()
+	handler := NewHandler(root)
+	handler.MaxFileSize = 1 << 16
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	sig, err := librsync.NewSignature(bytes.NewReader(nil), 8)
+	assert.NoError(t, err)
+	literal := &bytes.Buffer{}
+	assert.NoError(t, librsync.WriteDelta(bytes.NewReader([]byte("x")), sig, literal))
+	i := bytes.Index(literal.Bytes(), []byte{1, 0, 0, 0, 0, 0, 0, 0, 1, 'x'})
+	assert.GreaterOrEqual(t, i, 0)
+	hugeLiteral := append(append([]byte(nil), literal.Bytes()[:i]...), 1, 0x40, 0, 0, 0, 0, 0, 0, 0, 'x')
+	bomb := &bytes.Buffer{}
+	assert.NoError(t, librsync.WriteDelta(bytes.NewReader(make([]byte, 1<<20)), sig, bomb, librsync.WithCompression(librsync.CompressionDeflate), librsync.WithMaxLiteralSize(1<<20)))
+	selfCopies := &bytes.Buffer{}
+	assert.NoError(t, librsync.WriteDelta(bytes.NewReader(make([]byte, 1<<20)), sig, selfCopies, librsync.WithSelfCopyWindow(1<<16)))
+
+	tests := []struct {
+		desc     string
+		giveBody []byte
+	}{
+		{desc: "should reject huge literal length", giveBody: hugeLiteral},
+		{desc: "should reject inflated literal over limit", giveBody: bomb.Bytes()},
+		{desc: "should reject patched file over limit", giveBody: selfCopies.Bytes()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/delta/file", "application/octet-stream", bytes.NewReader(tc.giveBody))
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+			entries, err := ioutil.ReadDir(root)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 0)
+		})
+	}
+}
+
+func TestPushErrors(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0755))
+	localPath := filepath.Join(t.TempDir(), "local")
+	assert.NoError(t, ioutil.WriteFile(localPath, []byte("local content"), 0644))
+	handler := NewHandler(root)
+	handler.MaxDeltaSize = 8
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	err := client.Push(localPath, "dir", librsync.WithMaxLiteralSize(4))
+	assert.IsType(t, &StatusError{}, err)
+	err = client.Push(localPath, "too-big")
+	assert.IsType(t, &StatusError{}, err)
+	assert.Error(t, client.Push(filepath.Join(t.TempDir(), "missing"), "file"))
+}
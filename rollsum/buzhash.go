@@ -0,0 +1,33 @@
+package rollsum
+
+import "math/bits"
+
+type Buzhash struct {
+	hash  uint32
+	count int
+}
+
+func NewBuzhash() *Buzhash {
+	return &Buzhash{}
+}
+
+func (b *Buzhash) Init(in []byte) {
+	b.Reset()
+	b.count = len(in)
+	for _, elem := range in {
+		b.hash = bits.RotateLeft32(b.hash, 1) ^ byteTable[elem]
+	}
+}
+
+func (b *Buzhash) Reset() {
+	b.hash = 0
+	b.count = 0
+}
+
+func (b *Buzhash) Roll(out, in byte) {
+	b.hash = bits.RotateLeft32(b.hash, 1) ^ bits.RotateLeft32(byteTable[out], b.count) ^ byteTable[in]
+}
+
+func (b *Buzhash) Sum() uint32 {
+	return b.hash
+}
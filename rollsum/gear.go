@@ -0,0 +1,34 @@
+package rollsum
+
+type Gear struct {
+	hash  uint32
+	count int
+}
+
+func NewGear() *Gear {
+	return &Gear{}
+}
+
+func (g *Gear) Init(in []byte) {
+	g.Reset()
+	g.count = len(in)
+	for _, elem := range in {
+		g.hash = g.hash<<1 + byteTable[elem]
+	}
+}
+
+func (g *Gear) Reset() {
+	g.hash = 0
+	g.count = 0
+}
+
+func (g *Gear) Roll(out, in byte) {
+	g.hash = g.hash<<1 + byteTable[in]
+	if g.count < 32 {
+		g.hash -= byteTable[out] << g.count
+	}
+}
+
+func (g *Gear) Sum() uint32 {
+	return g.hash
+}
@@ -0,0 +1,38 @@
+package rollsum
+
+const (
+	rabinKarpSeed uint32 = 1
+	rabinKarpMult uint32 = 0x08104225
+	rabinKarpAdj  uint32 = rabinKarpMult - 1
+)
+
+type RabinKarp struct {
+	hash, mult uint32
+}
+
+func NewRabinKarp() *RabinKarp {
+	r := &RabinKarp{}
+	r.Reset()
+	return r
+}
+
+func (r *RabinKarp) Init(in []byte) {
+	r.Reset()
+	for _, elem := range in {
+		r.hash = r.hash*rabinKarpMult + uint32(elem)
+		r.mult *= rabinKarpMult
+	}
+}
+
+func (r *RabinKarp) Reset() {
+	r.hash = rabinKarpSeed
+	r.mult = 1
+}
+
+func (r *RabinKarp) Roll(out, in byte) {
+	r.hash = r.hash*rabinKarpMult + uint32(in) - r.mult*(uint32(out)+rabinKarpAdj)
+}
+
+func (r *RabinKarp) Sum() uint32 {
+	return r.hash
+}
@@ -1,19 +1,34 @@
 package rollsum
 
+const LibrsyncCharOffset uint16 = 31
+
+type RollingHash interface {
+	Init(in []byte)
+	Roll(out, in byte)
+	Sum() uint32
+	Reset()
+}
+
 type RollingSum struct {
 	a, b, count uint16
+	charOffset  uint16
 }
 
 func New() *RollingSum {
 	return &RollingSum{}
 }
 
+func NewWithCharOffset(offset uint16) *RollingSum {
+	return &RollingSum{charOffset: offset}
+}
+
 func (s *RollingSum) Init(in []byte) {
 	s.Reset()
 	s.count = uint16(len(in))
 	for i, elem := range in {
-		s.a += uint16(elem)
-		s.b += (s.count - uint16(i)) * uint16(elem)
+		c := uint16(elem) + s.charOffset
+		s.a += c
+		s.b += (s.count - uint16(i)) * c
 	}
 }
 
@@ -25,7 +40,7 @@ func (s *RollingSum) Reset() {
 
 func (s *RollingSum) Roll(out, in byte) {
 	s.a += uint16(in) - uint16(out)
-	s.b += s.a - s.count*uint16(out)
+	s.b += s.a - s.count*(uint16(out)+s.charOffset)
 }
 
 func (s *RollingSum) Sum() uint32 {
@@ -35,3 +35,77 @@ func TestRoll(t *testing.T) {
 		t.Errorf("sums do not match, r1Sum = %d; r2Sum = %d", r1Sum, r2Sum)
 	}
 }
+
+func TestRollWithCharOffset(t *testing.T) {
+	data := []byte{'h', 'e', 'l', 'l', 'o', ' ', 'w', 'o', 'r', 'l', 'd'}
+
+	r1 := NewWithCharOffset(LibrsyncCharOffset)
+	r1.Init(data[6:11])
+	r2 := NewWithCharOffset(LibrsyncCharOffset)
+	r2.Init(data[:5])
+	for i, b := range data[5:] {
+		r2.Roll(data[i], b)
+	}
+	r1Sum := r1.Sum()
+	r2Sum := r2.Sum()
+
+	if r1Sum != r2Sum {
+		t.Errorf("sums do not match, r1Sum = %d; r2Sum = %d", r1Sum, r2Sum)
+	}
+}
+
+func TestInitWithCharOffset(t *testing.T) {
+	giveData := []byte{1, 2, 3}
+	wantSum := uint32(12845155)
+
+	rSum := NewWithCharOffset(LibrsyncCharOffset)
+	rSum.Init(giveData)
+	gotSum := rSum.Sum()
+
+	if gotSum != wantSum {
+		t.Errorf("sums do not match, got = %d; want = %d", gotSum, wantSum)
+	}
+}
+
+func TestRollingHashes(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs")
+	hashes := map[string]func() RollingHash{
+		"rollsum":          func() RollingHash { return New() },
+		"rollsum-librsync": func() RollingHash { return NewWithCharOffset(LibrsyncCharOffset) },
+		"rabinkarp":        func() RollingHash { return NewRabinKarp() },
+		"buzhash":          func() RollingHash { return NewBuzhash() },
+		"gear":             func() RollingHash { return NewGear() },
+	}
+
+	for name, newHash := range hashes {
+		for _, window := range []int{1, 5, 31, 32, 33, 40} {
+			r1 := newHash()
+			r2 := newHash()
+			r2.Init(data[:window])
+			for i := window; i < len(data); i++ {
+				r2.Roll(data[i-window], data[i])
+				r1.Init(data[i-window+1 : i+1])
+				if r1.Sum() != r2.Sum() {
+					t.Errorf("%s: sums do not match at window = %d, offset = %d, r1Sum = %d; r2Sum = %d", name, window, i, r1.Sum(), r2.Sum())
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRabinKarpInit(t *testing.T) {
+	giveData := []byte{1, 2, 3}
+	wantSum := uint32(1)
+	for _, b := range giveData {
+		wantSum = wantSum*0x08104225 + uint32(b)
+	}
+
+	rSum := NewRabinKarp()
+	rSum.Init(giveData)
+	gotSum := rSum.Sum()
+
+	if gotSum != wantSum {
+		t.Errorf("sums do not match, got = %d; want = %d", gotSum, wantSum)
+	}
+}
@@ -0,0 +1,15 @@
+package rollsum
+
+var byteTable = newByteTable(0x9e3779b97f4a7c15)
+
+func newByteTable(seed uint64) [256]uint32 {
+	table := [256]uint32{}
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = uint32((z ^ (z >> 31)) >> 32)
+	}
+	return table
+}
@@ -0,0 +1,219 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+const (
+	signatureArchiveMagic uint32 = 0x72647473
+	deltaArchiveMagic     uint32 = 0x72647464
+
+	archiveFormatVersion uint8 = 1
+
+	maxPathLength = 1 << 16
+)
+
+type EntryKind uint8
+
+const (
+	KindDir EntryKind = iota
+	KindFile
+	KindSymlink
+	KindDeleted
+
+	kindEnd EntryKind = 0xff
+)
+
+var entryKindNames = map[EntryKind]string{
+	KindDir:     "dir",
+	KindFile:    "file",
+	KindSymlink: "symlink",
+	KindDeleted: "deleted",
+}
+
+func (k EntryKind) String() string {
+	if name, ok := entryKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("EntryKind(%d)", uint8(k))
+}
+
+type Entry struct {
+	Kind   EntryKind
+	Path   string
+	Mode   os.FileMode
+	Target string
+	Basis  string
+	Size   uint64
+	Hash   []byte
+	data   []byte
+}
+
+type archiveHeader struct {
+	Magic   uint32
+	Version uint8
+}
+
+var errTruncatedArchive = fmt.Errorf("truncated archive: %w", io.ErrUnexpectedEOF)
+
+func writeArchiveHeader(out io.Writer, magic uint32) error {
+	return binary.Write(out, binary.BigEndian, archiveHeader{Magic: magic, Version: archiveFormatVersion})
+}
+
+func readArchiveHeader(in io.Reader, magic uint32) error {
+	header := archiveHeader{}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return librsync.ErrTruncatedHeader
+		}
+		return err
+	}
+	if header.Magic != magic {
+		return fmt.Errorf("archive: %w, got = %#x, want = %#x", librsync.ErrInvalidMagic, header.Magic, magic)
+	}
+	if header.Version == 0 || header.Version > archiveFormatVersion {
+		return fmt.Errorf("archive: %w, got = %d, max supported = %d", librsync.ErrUnsupportedVersion, header.Version, archiveFormatVersion)
+	}
+	return nil
+}
+
+func writeEntry(out io.Writer, e *Entry) error {
+	if err := binary.Write(out, binary.BigEndian, e.Kind); err != nil {
+		return err
+	}
+	if err := writeString(out, e.Path); err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.BigEndian, uint32(e.Mode)); err != nil {
+		return err
+	}
+	switch e.Kind {
+	case KindSymlink:
+		return writeString(out, e.Target)
+	case KindFile:
+		if err := writeString(out, e.Basis); err != nil {
+			return err
+		}
+		if err := binary.Write(out, binary.BigEndian, e.Size); err != nil {
+			return err
+		}
+		if err := writeBytes(out, e.Hash); err != nil {
+			return err
+		}
+		return writeBytes(out, e.data)
+	}
+	return nil
+}
+
+func writeEnd(out io.Writer) error {
+	return binary.Write(out, binary.BigEndian, kindEnd)
+}
+
+func readEntry(in io.Reader) (*Entry, error) {
+	e := &Entry{}
+	if err := binary.Read(in, binary.BigEndian, &e.Kind); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTruncatedArchive
+		}
+		return nil, err
+	}
+	if e.Kind == kindEnd {
+		return nil, io.EOF
+	}
+	if _, ok := entryKindNames[e.Kind]; !ok {
+		return nil, fmt.Errorf("corrupted archive - unknown entry kind = %d", e.Kind)
+	}
+	var err error
+	if e.Path, err = readString(in); err != nil {
+		return nil, err
+	}
+	var mode uint32
+	if err := binary.Read(in, binary.BigEndian, &mode); err != nil {
+		return nil, truncated(err)
+	}
+	e.Mode = os.FileMode(mode)
+	switch e.Kind {
+	case KindSymlink:
+		if e.Target, err = readString(in); err != nil {
+			return nil, err
+		}
+	case KindFile:
+		if e.Basis, err = readString(in); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(in, binary.BigEndian, &e.Size); err != nil {
+			return nil, truncated(err)
+		}
+		if e.Hash, err = readBytes(in); err != nil {
+			return nil, err
+		}
+		if e.data, err = readBytes(in); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func writeString(out io.Writer, s string) error {
+	if len(s) > maxPathLength {
+		return fmt.Errorf("too long path, got = %d, max length = %d", len(s), maxPathLength)
+	}
+	if err := binary.Write(out, binary.BigEndian, uint32(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, s)
+	return err
+}
+
+func readString(in io.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(in, binary.BigEndian, &length); err != nil {
+		return "", truncated(err)
+	}
+	if length > maxPathLength {
+		return "", fmt.Errorf("corrupted archive - too long path, got = %d, max length = %d", length, maxPathLength)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return "", truncated(err)
+	}
+	return string(data), nil
+}
+
+func writeBytes(out io.Writer, data []byte) error {
+	if err := binary.Write(out, binary.BigEndian, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := out.Write(data)
+	return err
+}
+
+func readBytes(in io.Reader) ([]byte, error) {
+	var length uint64
+	if err := binary.Read(in, binary.BigEndian, &length); err != nil {
+		return nil, truncated(err)
+	}
+	buff := &bytes.Buffer{}
+	n, err := io.CopyN(buff, in, int64(length))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if uint64(n) != length {
+		return nil, errTruncatedArchive
+	}
+	return buff.Bytes(), nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errTruncatedArchive
+	}
+	return err
+}
@@ -0,0 +1,393 @@
+package tree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+)
+
+const modeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+func WriteSignature(root string, out io.Writer, blockLen uint32, opts ...librsync.SignatureOption) error {
+	return WriteSignatureContext(context.Background(), root, out, blockLen, opts...)
+}
+
+func WriteSignatureContext(ctx context.Context, root string, out io.Writer, blockLen uint32, opts ...librsync.SignatureOption) error {
+	entries, err := walk(root)
+	if err != nil {
+		return err
+	}
+	bufOut := bufio.NewWriter(out)
+	if err := writeArchiveHeader(bufOut, signatureArchiveMagic); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Kind == KindFile {
+			if err := signFile(ctx, root, e, blockLen, opts); err != nil {
+				return err
+			}
+		}
+		if err := writeEntry(bufOut, e); err != nil {
+			return err
+		}
+		e.data = nil
+	}
+	if err := writeEnd(bufOut); err != nil {
+		return err
+	}
+	return bufOut.Flush()
+}
+
+func signFile(ctx context.Context, root string, e *Entry, blockLen uint32, opts []librsync.SignatureOption) error {
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if blockLen == 0 {
+		blockLen = librsync.AutoBlockLength(int64(e.Size))
+	}
+	hash := sha256.New()
+	sig, err := librsync.NewSignatureContext(ctx, io.TeeReader(f, hash), blockLen, opts...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.Path, err)
+	}
+	buff := &bytes.Buffer{}
+	if err := sig.Write(buff); err != nil {
+		return err
+	}
+	e.Hash = hash.Sum(nil)
+	e.data = buff.Bytes()
+	return nil
+}
+
+func WriteDelta(signature io.Reader, root string, out io.Writer, opts ...librsync.DeltaOption) error {
+	return WriteDeltaContext(context.Background(), signature, root, out, opts...)
+}
+
+func WriteDeltaContext(ctx context.Context, signature io.Reader, root string, out io.Writer, opts ...librsync.DeltaOption) error {
+	basis, err := readArchive(bufio.NewReader(signature), signatureArchiveMagic)
+	if err != nil {
+		return err
+	}
+	entries, err := walk(root)
+	if err != nil {
+		return err
+	}
+	basisByPath := map[string]*Entry{}
+	basisByHash := map[string][]*Entry{}
+	for _, e := range basis {
+		basisByPath[e.Path] = e
+		if e.Kind == KindFile {
+			basisByHash[string(e.Hash)] = append(basisByHash[string(e.Hash)], e)
+		}
+	}
+	present := map[string]bool{}
+	for _, e := range entries {
+		present[e.Path] = true
+	}
+
+	bufOut := bufio.NewWriter(out)
+	if err := writeArchiveHeader(bufOut, deltaArchiveMagic); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Kind == KindFile {
+			if err := deltaFile(ctx, root, e, basisByPath, basisByHash, present, opts); err != nil {
+				return err
+			}
+		}
+		if err := writeEntry(bufOut, e); err != nil {
+			return err
+		}
+		e.data = nil
+	}
+	for _, e := range basis {
+		if !present[e.Path] {
+			if err := writeEntry(bufOut, &Entry{Kind: KindDeleted, Path: e.Path}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeEnd(bufOut); err != nil {
+		return err
+	}
+	return bufOut.Flush()
+}
+
+func deltaFile(ctx context.Context, root string, e *Entry, basisByPath map[string]*Entry, basisByHash map[string][]*Entry, present map[string]bool, opts []librsync.DeltaOption) error {
+	name := filepath.Join(root, filepath.FromSlash(e.Path))
+	basis, ok := basisByPath[e.Path]
+	if !ok || basis.Kind != KindFile {
+		hash, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+		basis = findRenamed(basisByHash[string(hash)], present)
+	}
+	sig, err := librsync.NewSignature(bytes.NewReader(nil), 1)
+	if err != nil {
+		return err
+	}
+	if basis != nil {
+		e.Basis = basis.Path
+		if sig, err = librsync.ReadSignature(bytes.NewReader(basis.data)); err != nil {
+			return fmt.Errorf("%s: %w", basis.Path, err)
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	delta, err := librsync.NewDeltaContext(ctx, f, sig, opts...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.Path, err)
+	}
+	buff := &bytes.Buffer{}
+	if err := delta.Write(buff); err != nil {
+		return err
+	}
+	e.data = buff.Bytes()
+	return nil
+}
+
+func findRenamed(candidates []*Entry, present map[string]bool) *Entry {
+	for _, c := range candidates {
+		if !present[c.Path] {
+			return c
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return nil
+}
+
+func hashFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func Patch(basisRoot string, delta io.Reader, targetRoot string) error {
+	return PatchContext(context.Background(), basisRoot, delta, targetRoot)
+}
+
+func PatchContext(ctx context.Context, basisRoot string, delta io.Reader, targetRoot string) error {
+	in := bufio.NewReader(delta)
+	if err := readArchiveHeader(in, deltaArchiveMagic); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(targetRoot, 0755); err != nil {
+		return err
+	}
+	if existing, err := ioutil.ReadDir(targetRoot); err != nil {
+		return err
+	} else if len(existing) > 0 {
+		return fmt.Errorf("target directory %s is not empty", targetRoot)
+	}
+	basisRoot, err := filepath.EvalSymlinks(basisRoot)
+	if err != nil {
+		return err
+	}
+	dirs := []*Entry{}
+	symlinks := map[string]bool{}
+	seen := map[string]bool{}
+	for {
+		e, err := readEntry(in)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := checkPath(e.Path, symlinks); err != nil {
+			return err
+		}
+		if e.Kind == KindDeleted {
+			continue
+		}
+		if seen[e.Path] {
+			return fmt.Errorf("corrupted archive - duplicate path %q", e.Path)
+		}
+		seen[e.Path] = true
+		name := filepath.Join(targetRoot, filepath.FromSlash(e.Path))
+		switch e.Kind {
+		case KindDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, e)
+		case KindSymlink:
+			if err := os.Symlink(e.Target, name); err != nil {
+				return err
+			}
+			symlinks[e.Path] = true
+		case KindFile:
+			if err := patchFile(ctx, basisRoot, e, name); err != nil {
+				return fmt.Errorf("%s: %w", e.Path, err)
+			}
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name := filepath.Join(targetRoot, filepath.FromSlash(dirs[i].Path))
+		if err := os.Chmod(name, dirs[i].Mode&modeMask); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func patchFile(ctx context.Context, basisRoot string, e *Entry, name string) error {
+	var base io.ReadSeeker = bytes.NewReader(nil)
+	if e.Basis != "" {
+		if err := checkPath(e.Basis, nil); err != nil {
+			return err
+		}
+		basisName := filepath.Join(basisRoot, filepath.FromSlash(e.Basis))
+		info, err := os.Lstat(basisName)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("basis %s is not a regular file", e.Basis)
+		}
+		if err := checkResolved(basisRoot, basisName); err != nil {
+			return err
+		}
+		f, err := os.Open(basisName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		base = f
+	}
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := librsync.ApplyPatchContext(ctx, base, bytes.NewReader(e.data), out); err != nil {
+		out.Close()
+		os.Remove(name)
+		return err
+	}
+	if err := out.Chmod(e.Mode & modeMask); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func checkPath(p string, symlinks map[string]bool) error {
+	if p == "." {
+		return nil
+	}
+	if p == "" || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, "\\") {
+		return fmt.Errorf("corrupted archive - invalid path %q", p)
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if symlinks[dir] {
+			return fmt.Errorf("corrupted archive - path %q goes through symlink %q", p, dir)
+		}
+	}
+	return nil
+}
+
+func checkResolved(root, name string) error {
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("basis %s resolves outside of %s", name, root)
+	}
+	return nil
+}
+
+func ReadManifest(in io.Reader) ([]Entry, error) {
+	entries, err := readArchive(bufio.NewReader(in), deltaArchiveMagic)
+	if err != nil {
+		return nil, err
+	}
+	manifest := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		e.data = nil
+		manifest = append(manifest, *e)
+	}
+	return manifest, nil
+}
+
+func readArchive(in io.Reader, magic uint32) ([]*Entry, error) {
+	if err := readArchiveHeader(in, magic); err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for {
+		e, err := readEntry(in)
+		if err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+func walk(root string) ([]*Entry, error) {
+	entries := []*Entry{}
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		e := &Entry{Path: filepath.ToSlash(rel), Mode: info.Mode() & modeMask}
+		switch {
+		case info.IsDir():
+			e.Kind = KindDir
+		case info.Mode().IsRegular():
+			e.Kind = KindFile
+			e.Size = uint64(info.Size())
+		case info.Mode()&os.ModeSymlink != 0:
+			e.Kind = KindSymlink
+			if e.Target, err = os.Readlink(name); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported file type %s", rel, info.Mode().Type())
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
@@ -0,0 +1,233 @@
+package tree
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pirellik/simple-rdiff/librsync"
+	"github.com/stretchr/testify/assert"
+)
+
+type fileSpec struct {
+	content string
+	mode    os.FileMode
+	target  string
+	dir     bool
+}
+
+func makeTree(t *testing.T, files map[string]fileSpec) string {
+	root := t.TempDir()
+	for name, spec := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		switch {
+		case spec.dir:
+			assert.NoError(t, os.MkdirAll(p, 0755))
+			assert.NoError(t, os.Chmod(p, spec.mode))
+		case spec.target != "":
+			assert.NoError(t, os.Symlink(spec.target, p))
+		default:
+			assert.NoError(t, ioutil.WriteFile(p, []byte(spec.content), 0644))
+			assert.NoError(t, os.Chmod(p, spec.mode))
+		}
+	}
+	return root
+}
+
+func readTree(t *testing.T, root string) map[string]fileSpec {
+	files := map[string]fileSpec{}
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil || name == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, name)
+		rel = filepath.ToSlash(rel)
+		switch {
+		case info.IsDir():
+			files[rel] = fileSpec{dir: true, mode: info.Mode().Perm()}
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(name)
+			assert.NoError(t, err)
+			files[rel] = fileSpec{target: target}
+		default:
+			content, err := ioutil.ReadFile(name)
+			assert.NoError(t, err)
+			files[rel] = fileSpec{content: string(content), mode: info.Mode().Perm()}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return files
+}
+
+func roundTrip(t *testing.T, basis, target string, opts ...librsync.DeltaOption) (string, []Entry) {
+	sig := &bytes.Buffer{}
+	assert.NoError(t, WriteSignature(basis, sig, 0))
+	delta := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(sig, target, delta, opts...))
+	manifest, err := ReadManifest(bytes.NewReader(delta.Bytes()))
+	assert.NoError(t, err)
+	out := filepath.Join(t.TempDir(), "out")
+	assert.NoError(t, Patch(basis, delta, out))
+	return out, manifest
+}
+
+func TestTreeRoundTrip(t *testing.T) {
+	long := string(bytes.Repeat([]byte("some long line of file content\n"), 500))
+	basis := makeTree(t, map[string]fileSpec{
+		"unchanged.txt":      {content: "same", mode: 0644},
+		"modified.txt":       {content: long, mode: 0644},
+		"deleted.txt":        {content: "gone", mode: 0644},
+		"old/renamed.bin":    {content: long + "renamed", mode: 0755},
+		"chmod.sh":           {content: "#!/bin/sh", mode: 0644},
+		"link":               {target: "unchanged.txt"},
+		"private":            {dir: true, mode: 0700},
+		"private/secret.txt": {content: "secret", mode: 0600},
+	})
+	wantFiles := map[string]fileSpec{
+		"unchanged.txt":      {content: "same", mode: 0644},
+		"modified.txt":       {content: long[:1000] + "changed" + long[1000:], mode: 0644},
+		"added.txt":          {content: "new file", mode: 0640},
+		"new/renamed.bin":    {content: long + "renamed", mode: 0755},
+		"chmod.sh":           {content: "#!/bin/sh", mode: 0755},
+		"link":               {target: "modified.txt"},
+		"private":            {dir: true, mode: 0700},
+		"private/secret.txt": {content: "secret", mode: 0600},
+		"empty":              {dir: true, mode: 0750},
+	}
+	target := makeTree(t, wantFiles)
+	wantFiles["new"] = fileSpec{dir: true, mode: 0755}
+
+	out, manifest := roundTrip(t, basis, target, librsync.WithCompression(librsync.CompressionDeflate))
+	assert.Equal(t, wantFiles, readTree(t, out))
+
+	byPath := map[string]Entry{}
+	for _, e := range manifest {
+		byPath[e.Path] = e
+	}
+	assert.Equal(t, "old/renamed.bin", byPath["new/renamed.bin"].Basis)
+	assert.Equal(t, "", byPath["added.txt"].Basis)
+	assert.Equal(t, "modified.txt", byPath["modified.txt"].Basis)
+	assert.Equal(t, KindDeleted, byPath["deleted.txt"].Kind)
+	assert.Equal(t, KindDeleted, byPath["old"].Kind)
+	assert.Equal(t, KindSymlink, byPath["link"].Kind)
+}
+
+func TestTreeContext(t *testing.T) {
+	basis := makeTree(t, map[string]fileSpec{"a": {content: "a", mode: 0644}})
+	sig := &bytes.Buffer{}
+	assert.NoError(t, WriteSignature(basis, sig, 0))
+	delta := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(bytes.NewReader(sig.Bytes()), basis, delta))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, WriteSignatureContext(ctx, basis, ioutil.Discard, 0), context.Canceled)
+	assert.ErrorIs(t, WriteDeltaContext(ctx, bytes.NewReader(sig.Bytes()), basis, ioutil.Discard), context.Canceled)
+	assert.ErrorIs(t, PatchContext(ctx, basis, delta, filepath.Join(t.TempDir(), "out")), context.Canceled)
+}
+
+func TestPatchRejectsNonEmptyTarget(t *testing.T) {
+	basis := makeTree(t, map[string]fileSpec{"a": {content: "a", mode: 0644}})
+	sig := &bytes.Buffer{}
+	assert.NoError(t, WriteSignature(basis, sig, 0))
+	delta := &bytes.Buffer{}
+	assert.NoError(t, WriteDelta(sig, basis, delta))
+
+	assert.Error(t, Patch(basis, delta, basis))
+}
+
+func TestPatchRejectsUnsafePaths(t *testing.T) {
+	tests := []struct {
+		desc        string
+		giveEntries []*Entry
+	}{
+		{desc: "should reject absolute path", giveEntries: []*Entry{{Kind: KindDir, Path: "/etc"}}},
+		{desc: "should reject parent path", giveEntries: []*Entry{{Kind: KindDir, Path: "../escape"}}},
+		{desc: "should reject unclean path", giveEntries: []*Entry{{Kind: KindDir, Path: "a/../../escape"}}},
+		{desc: "should reject path through symlink", giveEntries: []*Entry{
+			{Kind: KindSymlink, Path: "link", Target: "/tmp"},
+			{Kind: KindDir, Path: "link/escape"},
+		}},
+		{desc: "should reject unsafe basis", giveEntries: []*Entry{{Kind: KindFile, Path: "a", Basis: "../secret"}}},
+		{desc: "should reject duplicate path", giveEntries: []*Entry{
+			{Kind: KindFile, Path: "a"},
+			{Kind: KindFile, Path: "a"},
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			archive := &bytes.Buffer{}
+			assert.NoError(t, writeArchiveHeader(archive, deltaArchiveMagic))
+			for _, e := range tc.giveEntries {
+				assert.NoError(t, writeEntry(archive, e))
+			}
+			assert.NoError(t, writeEnd(archive))
+
+			err := Patch(t.TempDir(), archive, filepath.Join(t.TempDir(), "out"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPatchDoesNotWriteThroughSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim")
+	assert.NoError(t, ioutil.WriteFile(victim, []byte("original"), 0644))
+	archive := &bytes.Buffer{}
+	assert.NoError(t, writeArchiveHeader(archive, deltaArchiveMagic))
+	assert.NoError(t, writeEntry(archive, &Entry{Kind: KindSymlink, Path: "x", Target: victim}))
+	assert.NoError(t, writeEntry(archive, &Entry{Kind: KindFile, Path: "x", Mode: 0644}))
+	assert.NoError(t, writeEnd(archive))
+
+	err := Patch(t.TempDir(), archive, filepath.Join(t.TempDir(), "out"))
+	assert.Error(t, err)
+	got, err := ioutil.ReadFile(victim)
+	assert.NoError(t, err)
+	assert.Equal(t, "original", string(got))
+}
+
+func TestPatchConfinesBasis(t *testing.T) {
+	outside := makeTree(t, map[string]fileSpec{"secret": {content: "secret", mode: 0600}})
+	basis := makeTree(t, map[string]fileSpec{"link": {target: outside}})
+	archive := &bytes.Buffer{}
+	assert.NoError(t, writeArchiveHeader(archive, deltaArchiveMagic))
+	assert.NoError(t, writeEntry(archive, &Entry{Kind: KindFile, Path: "a", Basis: "link/secret"}))
+	assert.NoError(t, writeEnd(archive))
+
+	err := Patch(basis, archive, filepath.Join(t.TempDir(), "out"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "resolves outside")
+	}
+}
+
+func TestReadArchiveErrors(t *testing.T) {
+	valid := &bytes.Buffer{}
+	assert.NoError(t, writeArchiveHeader(valid, deltaArchiveMagic))
+	assert.NoError(t, writeEntry(valid, &Entry{Kind: KindFile, Path: "file", data: []byte("data")}))
+	assert.NoError(t, writeEnd(valid))
+
+	tests := []struct {
+		desc      string
+		giveInput []byte
+		wantErr   error
+	}{
+		{desc: "should reject signature archive", giveInput: []byte{0x72, 0x64, 0x74, 0x73, 1}, wantErr: librsync.ErrInvalidMagic},
+		{desc: "should reject truncated header", giveInput: valid.Bytes()[:3], wantErr: librsync.ErrTruncatedHeader},
+		{desc: "should reject truncated entry", giveInput: valid.Bytes()[:valid.Len()-3], wantErr: io.ErrUnexpectedEOF},
+		{desc: "should reject missing end", giveInput: valid.Bytes()[:valid.Len()-1], wantErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadManifest(bytes.NewReader(tc.giveInput))
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}